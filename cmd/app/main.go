@@ -12,6 +12,7 @@ import (
 
 	"aiadvent/internal/auth"
 	"aiadvent/internal/config"
+	"aiadvent/internal/health"
 	"aiadvent/internal/httpserver"
 	"aiadvent/internal/llm"
 	"aiadvent/internal/telegram"
@@ -24,26 +25,91 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	logger := newLogger(cfg.LogLevel)
 
 	httpClient := transport.NewHTTPClient(cfg.RequestTimeout)
-	llmClient := llm.NewOpenRouterClient(cfg.OpenRouter, httpClient, logger)
+	var (
+		providerClient llm.Client
+		defaultModel   string
+	)
+	switch cfg.LLMProvider {
+	case "anthropic":
+		providerClient = llm.NewAnthropicClient(cfg.Anthropic, httpClient, logger)
+		defaultModel = cfg.Anthropic.DefaultModel
+	default:
+		providerClient = llm.NewOpenRouterClient(cfg.OpenRouter, httpClient, logger)
+		defaultModel = cfg.OpenRouter.DefaultModel
+	}
+	if len(cfg.LLMFallbackModels) > 0 {
+		providerClient = llm.NewFallbackClient(providerClient, defaultModel, cfg.LLMFallbackModels, logger)
+	}
+	trackedClient := llm.NewTrackedClient(providerClient)
+	// Одинаковые одновременные запросы (повторные нажатия, одинаковые вопросы) идут к провайдеру один раз.
+	var llmClient llm.Client = llm.NewSingleflightClient(trackedClient)
+	if cfg.LLMCacheSize > 0 {
+		llmClient = llm.NewCachedClient(llmClient, cfg.LLMCacheSize, cfg.LLMCacheTTL)
+	}
+	dialogCfg := llm.DialogServiceConfig{
+		MaxHistoryMessages:  cfg.Dialog.MaxHistory,
+		SummarizeThreshold:  cfg.Dialog.SummarizeThreshold,
+		SummarizeKeepRecent: cfg.Dialog.SummarizeKeep,
+		Logger:              logger,
+	}
+	if cfg.Dialog.SummarizeThreshold > 0 {
+		dialogCfg.Summarizer = llm.NewClientSummarizer(llmClient, "")
+	}
+	dialogService := llm.NewDialogService(llmClient, llm.NewMemoryDialogStore(cfg.Dialog.TTL, cfg.Dialog.MaxCount), dialogCfg)
 
 	var store auth.Store
+	closeStore := func() error { return nil }
 	switch strings.ToLower(cfg.AuthStoreType) {
 	case "memory":
 		store = auth.NewMemoryStore()
+	case "sqlite":
+		sqliteStore, err := auth.NewSQLiteStore(cfg.AuthStorePath)
+		if err != nil {
+			log.Fatalf("failed to init sqlite store: %v", err)
+		}
+		store = sqliteStore
+		closeStore = sqliteStore.Close
 	default:
-		fileStore, err := auth.NewFileStore(cfg.AuthStorePath)
+		var fileStore *auth.FileStore
+		if cfg.AuthStoreFlushInterval > 0 {
+			fileStore, err = auth.NewBatchedFileStore(cfg.AuthStorePath, cfg.AuthStoreFlushInterval)
+		} else {
+			fileStore, err = auth.NewFileStore(cfg.AuthStorePath)
+		}
 		if err != nil {
 			log.Fatalf("failed to init file store: %v", err)
 		}
 		store = fileStore
+		closeStore = fileStore.Close
+	}
+	credentials := make([]auth.Credential, 0, len(cfg.AuthCredentials)+1)
+	for password, role := range cfg.AuthCredentials {
+		credentials = append(credentials, auth.Credential{Password: password, Role: auth.Role(role)})
+	}
+	// Хеш имеет приоритет: открытый ADMIN_PASSWORD используется, только если хеш не задан.
+	switch {
+	case cfg.AdminPasswordHash != "":
+		credentials = append(credentials, auth.Credential{PasswordHash: cfg.AdminPasswordHash, Role: auth.RoleAdmin})
+	case cfg.AdminPassword != "":
+		credentials = append(credentials, auth.Credential{Password: cfg.AdminPassword, Role: auth.RoleAdmin})
 	}
-	authService := auth.NewService(cfg.AdminPassword, cfg.SessionTTL, store)
+	authOpts := []auth.Option{auth.WithLoginThrottle(cfg.LoginMaxAttempts, cfg.LoginLockout)}
+	if cfg.SessionExpiryMode == "sliding" {
+		authOpts = append(authOpts, auth.WithSlidingExpiry())
+	}
+	authService := auth.NewServiceWithCredentials(credentials, cfg.SessionTTL, store, authOpts...)
 
 	telegramClient := telegram.NewClient(cfg.Telegram, httpClient)
+	if cfg.Telegram.WebhookURL != "" {
+		registerWebhook(telegramClient, cfg.Telegram, logger)
+	}
 	webhookHandler := telegram.NewWebhookHandler(telegram.WebhookDeps{
 		Auth:          authService,
 		LLM:           llmClient,
@@ -52,24 +118,51 @@ func main() {
 		AdminPassword: cfg.AdminPassword,
 		SessionTTL:    cfg.SessionTTL,
 		WebhookSecret: cfg.Telegram.WebhookSecret,
+		Dialogs:       dialogService,
+		AskMemory:     cfg.AskMemory,
+		LanguageHints: cfg.AskLanguageHint,
+
+		AllowedChatIDs: cfg.Telegram.AllowedChatIDs,
+		DedupWindow:    cfg.Telegram.DedupWindow,
+		MaxBodyBytes:   cfg.Telegram.MaxBodyBytes,
+
+		ProcessingTimeout: cfg.ProcessingTimeout,
+		AcquireTimeout:    cfg.AcquireTimeout,
+		MaxWorkers:        cfg.MaxWorkers,
 	})
 
+	healthChecker := health.NewChecker(cfg.HealthCacheTTL)
+	healthChecker.Register("telegram", func(ctx context.Context) error {
+		_, err := telegramClient.GetMe(ctx)
+		return err
+	})
+	healthChecker.Register("llm", trackedClient.Probe)
+
 	router := httpserver.NewRouter(httpserver.RouterDeps{
 		Logger:          logger,
 		TelegramHandler: webhookHandler,
+		HealthHandler:   healthChecker,
 	})
 
 	server := &http.Server{
 		Addr:         cfg.HTTPAddr,
 		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	janitorDone := make(chan struct{})
+	go func() {
+		defer close(janitorDone)
+		if cfg.SessionTTL > 0 && cfg.AuthCleanupInterval > 0 {
+			runSessionJanitor(ctx, store, cfg.AuthCleanupInterval, logger)
+		}
+	}()
+
 	go func() {
 		logger.Info("server starting", slog.String("addr", cfg.HTTPAddr))
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -81,16 +174,56 @@ func main() {
 	<-ctx.Done()
 	logger.Info("shutdown initiated")
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		logger.Error("shutdown error", slog.String("error", err.Error()))
 	}
+	<-janitorDone
+	if err := closeStore(); err != nil {
+		logger.Error("auth store close error", slog.String("error", err.Error()))
+	}
 
 	logger.Info("server stopped")
 }
 
+// registerWebhook сообщает Telegram адрес вебхука и секрет. Ошибка не останавливает
+// запуск: вебхук мог быть зарегистрирован раньше вручную.
+func registerWebhook(bot telegram.BotClient, cfg config.TelegramConfig, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := bot.SetWebhook(ctx, cfg.WebhookURL, cfg.WebhookSecret, 0); err != nil {
+		logger.Error("webhook registration failed", slog.String("url", cfg.WebhookURL), slog.String("error", err.Error()))
+		return
+	}
+	logger.Info("webhook registered", slog.String("url", cfg.WebhookURL))
+}
+
+// runSessionJanitor периодически удаляет истекшие сессии, до которых не дошла ленивая
+// очистка в IsAuthorized (пользователь больше не писал боту). Завершается при отмене ctx.
+func runSessionJanitor(ctx context.Context, store auth.Store, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			removed, err := store.DeleteExpired(now)
+			if err != nil {
+				logger.Error("auth session cleanup failed", slog.String("error", err.Error()))
+				continue
+			}
+			if removed > 0 {
+				logger.Info("auth sessions cleaned up", slog.Int("removed", removed))
+			}
+		}
+	}
+}
+
 func newLogger(level string) *slog.Logger {
 	slogLevel := slog.LevelInfo
 	switch level {
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 )
 
 // FileStore хранит сессии в памяти и синхронизирует их с JSON-файлом на диске.
@@ -17,6 +18,14 @@ type FileStore struct {
 	mu       sync.RWMutex
 	sessions map[int64]Session
 	path     string
+
+	// В пакетном режиме (flushInterval > 0) изменения копятся и сбрасываются на диск фоном.
+	flushInterval time.Duration
+	dirty         bool
+	writeMu       sync.Mutex
+	stop          chan struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
 }
 
 // NewFileStore создает FileStore и загружает данные из указанного файла.
@@ -36,12 +45,35 @@ func NewFileStore(path string) (*FileStore, error) {
 	return fs, nil
 }
 
+// NewBatchedFileStore создает FileStore, который не пишет файл на каждое изменение,
+// а сбрасывает накопленные изменения раз в flushInterval и при Close.
+// Запись по-прежнему атомарная (временный файл + rename).
+func NewBatchedFileStore(path string, flushInterval time.Duration) (*FileStore, error) {
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("flush interval must be positive")
+	}
+
+	fs, err := NewFileStore(path)
+	if err != nil {
+		return nil, err
+	}
+	fs.flushInterval = flushInterval
+	fs.stop = make(chan struct{})
+	fs.done = make(chan struct{})
+	go fs.flushLoop()
+	return fs, nil
+}
+
 // Save сохраняет/обновляет сессию и атомарно записывает состояние на диск.
 func (s *FileStore) Save(session Session) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.sessions[session.UserID] = session
+	if s.flushInterval > 0 {
+		s.dirty = true
+		return nil
+	}
 	return s.persistLocked()
 }
 
@@ -61,11 +93,102 @@ func (s *FileStore) Delete(userID int64) {
 	defer s.mu.Unlock()
 
 	delete(s.sessions, userID)
+	if s.flushInterval > 0 {
+		s.dirty = true
+		return
+	}
 	if err := s.persistLocked(); err != nil {
 		log.Printf("filestore: persist after delete failed: %v", err)
 	}
 }
 
+// AllUserIDs возвращает id всех сессий в памяти, включая еще не сброшенные на диск.
+func (s *FileStore) AllUserIDs() ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedUserIDs(s.sessions), nil
+}
+
+// DeleteExpired удаляет истекшие сессии и записывает новое состояние на диск,
+// если что-то было удалено.
+func (s *FileStore) DeleteExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := deleteExpired(s.sessions, now)
+	if removed == 0 {
+		return 0, nil
+	}
+	if s.flushInterval > 0 {
+		s.dirty = true
+		return removed, nil
+	}
+	if err := s.persistLocked(); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// Flush записывает накопленные изменения на диск, если они есть.
+// Состояние сериализуется под блокировкой, а сама запись идет без нее,
+// чтобы Save/Get не ждали диск.
+func (s *FileStore) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := s.marshalLocked()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err := s.writeFile(data); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close останавливает фоновый сброс и гарантированно записывает последние изменения.
+// Для FileStore без пакетного режима ничего не делает.
+func (s *FileStore) Close() error {
+	if s.flushInterval <= 0 {
+		return nil
+	}
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return s.Flush()
+}
+
+func (s *FileStore) flushLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Printf("filestore: background flush failed: %v", err)
+			}
+		}
+	}
+}
+
 func (s *FileStore) load() error {
 	dir := filepath.Dir(s.path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -105,11 +228,14 @@ func (s *FileStore) load() error {
 }
 
 func (s *FileStore) persistLocked() error {
-	dir := filepath.Dir(s.path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("create store dir: %w", err)
+	data, err := s.marshalLocked()
+	if err != nil {
+		return err
 	}
+	return s.writeFile(data)
+}
 
+func (s *FileStore) marshalLocked() ([]byte, error) {
 	payload := make(map[string]Session, len(s.sessions))
 	for id, session := range s.sessions {
 		payload[strconv.FormatInt(id, 10)] = session
@@ -117,7 +243,16 @@ func (s *FileStore) persistLocked() error {
 
 	data, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
-		return fmt.Errorf("marshal sessions: %w", err)
+		return nil, fmt.Errorf("marshal sessions: %w", err)
+	}
+	return data, nil
+}
+
+// writeFile атомарно заменяет файл хранилища содержимым data.
+func (s *FileStore) writeFile(data []byte) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create store dir: %w", err)
 	}
 
 	tmpFile, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp")
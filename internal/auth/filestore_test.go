@@ -19,6 +19,7 @@ func TestFileStoreSaveAndLoad(t *testing.T) {
 		UserID:    123,
 		Token:     "tok_123",
 		ExpiresAt: time.Now().Add(time.Hour),
+		Role:      RoleAdmin,
 	}
 	if err := store.Save(original); err != nil {
 		t.Fatalf("save session: %v", err)
@@ -37,7 +38,161 @@ func TestFileStoreSaveAndLoad(t *testing.T) {
 	if loaded.Token != original.Token {
 		t.Fatalf("token mismatch after reload: got %s want %s", loaded.Token, original.Token)
 	}
+	if loaded.Role != original.Role {
+		t.Fatalf("role mismatch after reload: got %s want %s", loaded.Role, original.Role)
+	}
 	if !loaded.ExpiresAt.Equal(original.ExpiresAt) {
 		t.Fatalf("expires mismatch after reload: got %v want %v", loaded.ExpiresAt, original.ExpiresAt)
 	}
 }
+
+func TestBatchedFileStoreFlushesOnClose(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "auth_sessions.json")
+
+	store, err := NewBatchedFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("new batched filestore: %v", err)
+	}
+
+	for id := int64(1); id <= 50; id++ {
+		if err := store.Save(Session{UserID: id, Token: "tok", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatalf("save session %d: %v", id, err)
+		}
+	}
+	store.Delete(7)
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reload filestore: %v", err)
+	}
+	for id := int64(1); id <= 50; id++ {
+		_, ok := reloaded.Get(id)
+		if id == 7 && ok {
+			t.Fatalf("deleted session must not be persisted")
+		}
+		if id != 7 && !ok {
+			t.Fatalf("session %d lost after close", id)
+		}
+	}
+}
+
+func TestBatchedFileStoreFlushesInBackground(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "auth_sessions.json")
+
+	store, err := NewBatchedFileStore(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("new batched filestore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Save(Session{UserID: 1, Token: "tok"}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		reloaded, err := NewFileStore(path)
+		if err != nil {
+			t.Fatalf("reload filestore: %v", err)
+		}
+		if _, ok := reloaded.Get(1); ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("session was not flushed in background")
+}
+
+func TestFileStoreDeleteExpiredPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_sessions.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("new filestore: %v", err)
+	}
+
+	now := time.Now()
+	sessions := []Session{
+		{UserID: 1, Token: "expired", ExpiresAt: now.Add(-time.Minute)},
+		{UserID: 2, Token: "active", ExpiresAt: now.Add(time.Hour)},
+		{UserID: 3, Token: "forever"},
+	}
+	for _, session := range sessions {
+		if err := store.Save(session); err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+	}
+
+	removed, err := store.DeleteExpired(now)
+	if err != nil {
+		t.Fatalf("delete expired: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 removed session, got %d", removed)
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reload filestore: %v", err)
+	}
+	if _, ok := reloaded.Get(1); ok {
+		t.Fatalf("expired session should be purged from disk")
+	}
+	for _, id := range []int64{2, 3} {
+		if _, ok := reloaded.Get(id); !ok {
+			t.Fatalf("session %d should be kept", id)
+		}
+	}
+}
+
+func TestMemoryStoreDeleteExpired(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	_ = store.Save(Session{UserID: 1, ExpiresAt: now.Add(-time.Second)})
+	_ = store.Save(Session{UserID: 2, ExpiresAt: now.Add(time.Second)})
+
+	removed, _ := store.DeleteExpired(now)
+	if removed != 1 {
+		t.Fatalf("expected 1 removed session, got %d", removed)
+	}
+	if _, ok := store.Get(1); ok {
+		t.Fatalf("expired session should be removed")
+	}
+	if _, ok := store.Get(2); !ok {
+		t.Fatalf("active session should be kept")
+	}
+}
+
+func BenchmarkFileStoreSave(b *testing.B) {
+	b.Run("sync", func(b *testing.B) {
+		store, err := NewFileStore(filepath.Join(b.TempDir(), "auth_sessions.json"))
+		if err != nil {
+			b.Fatalf("new filestore: %v", err)
+		}
+		benchmarkSave(b, store)
+	})
+	b.Run("batched", func(b *testing.B) {
+		store, err := NewBatchedFileStore(filepath.Join(b.TempDir(), "auth_sessions.json"), 50*time.Millisecond)
+		if err != nil {
+			b.Fatalf("new batched filestore: %v", err)
+		}
+		defer store.Close()
+		benchmarkSave(b, store)
+	})
+}
+
+func benchmarkSave(b *testing.B, store *FileStore) {
+	session := Session{Token: "tok", ExpiresAt: time.Now().Add(time.Hour)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		session.UserID = int64(i % 100)
+		if err := store.Save(session); err != nil {
+			b.Fatalf("save: %v", err)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package auth
 
-import "sync"
+import (
+	"sort"
+	"sync"
+	"time"
+)
 
 // MemoryStore простое in-memory хранилище сессий, потокобезопасное.
 type MemoryStore struct {
@@ -33,3 +37,37 @@ func (s *MemoryStore) Delete(userID int64) {
 	defer s.mu.Unlock()
 	delete(s.sessions, userID)
 }
+
+func (s *MemoryStore) DeleteExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return deleteExpired(s.sessions, now), nil
+}
+
+func (s *MemoryStore) AllUserIDs() ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedUserIDs(s.sessions), nil
+}
+
+// sortedUserIDs возвращает ключи карты по возрастанию, чтобы порядок был стабильным.
+func sortedUserIDs(sessions map[int64]Session) []int64 {
+	ids := make([]int64, 0, len(sessions))
+	for id := range sessions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// deleteExpired удаляет из карты истекшие сессии и возвращает их число.
+func deleteExpired(sessions map[int64]Session, now time.Time) int {
+	removed := 0
+	for id, session := range sessions {
+		if !session.ExpiresAt.IsZero() && now.After(session.ExpiresAt) {
+			delete(sessions, id)
+			removed++
+		}
+	}
+	return removed
+}
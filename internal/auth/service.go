@@ -2,54 +2,157 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrTooManyAttempts возвращается, пока пользователь заблокирован после серии неудачных входов.
+	ErrTooManyAttempts = errors.New("too many login attempts")
 )
 
-var ErrUnauthorized = errors.New("unauthorized")
+// Role определяет набор доступных пользователю команд.
+type Role string
+
+const (
+	RoleAdmin Role = "admin"
+	RoleUser  Role = "user"
+)
 
 type Session struct {
 	UserID    int64
 	Token     string
 	ExpiresAt time.Time
+	// Role пустая у сессий, созданных до появления ролей; такие сессии считаются RoleUser.
+	Role Role
 }
 
 type Store interface {
 	Save(session Session) error
 	Get(userID int64) (Session, bool)
 	Delete(userID int64)
+	// DeleteExpired удаляет сессии, истекшие к моменту now, и возвращает их число.
+	// Сессии без срока (нулевой ExpiresAt) не трогает.
+	DeleteExpired(now time.Time) (int, error)
+	// AllUserIDs возвращает id всех сохраненных сессий (включая еще не удаленные истекшие).
+	AllUserIDs() ([]int64, error)
+}
+
+// Credential пароль, дающий роль. Если задан PasswordHash (bcrypt), Password игнорируется.
+type Credential struct {
+	Password     string
+	PasswordHash string
+	Role         Role
 }
 
 type Service struct {
-	password string
-	ttl      time.Duration
-	store    Store
+	credentials []Credential
+	ttl         time.Duration
+	store       Store
+
+	sliding     bool
+	maxAttempts int
+	lockout     time.Duration
+	attemptsMu  sync.Mutex
+	attempts    map[int64]loginAttempts
+	now         func() time.Time
 }
 
+type loginAttempts struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+// Option настраивает Service.
+type Option func(*Service)
+
+// WithSlidingExpiry продлевает сессию на ttl при каждой успешной проверке авторизации,
+// чтобы активные пользователи не разлогинивались посреди работы.
+func WithSlidingExpiry() Option {
+	return func(s *Service) {
+		s.sliding = true
+	}
+}
+
+// WithLoginThrottle блокирует вход на lockout после maxAttempts неудачных попыток подряд.
+// maxAttempts <= 0 отключает ограничение.
+func WithLoginThrottle(maxAttempts int, lockout time.Duration) Option {
+	return func(s *Service) {
+		s.maxAttempts = maxAttempts
+		s.lockout = lockout
+	}
+}
+
+// NewService создает сервис с единственным паролем администратора.
+// Пустой пароль отключает проверку: любой пароль дает роль администратора.
 func NewService(password string, ttl time.Duration, store Store) *Service {
-	return &Service{
-		password: password,
-		ttl:      ttl,
-		store:    store,
+	credentials := map[string]Role{}
+	if password != "" {
+		credentials[password] = RoleAdmin
+	}
+	return NewServiceWithRoles(credentials, ttl, store)
+}
+
+// NewServiceWithRoles создает сервис с набором паролей в открытом виде, каждый из которых дает свою роль.
+func NewServiceWithRoles(credentials map[string]Role, ttl time.Duration, store Store) *Service {
+	creds := make([]Credential, 0, len(credentials))
+	for password, role := range credentials {
+		creds = append(creds, Credential{Password: password, Role: role})
+	}
+	return NewServiceWithCredentials(creds, ttl, store)
+}
+
+// NewServiceWithCredentials создает сервис с паролями в открытом виде и/или bcrypt-хешами.
+func NewServiceWithCredentials(credentials []Credential, ttl time.Duration, store Store, opts ...Option) *Service {
+	s := &Service{
+		credentials: append([]Credential(nil), credentials...),
+		ttl:         ttl,
+		store:       store,
+		attempts:    make(map[int64]loginAttempts),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-// Login проверяет пароль и создает сессию.
+// Login проверяет пароль и создает сессию с ролью, соответствующей паролю.
 func (s *Service) Login(ctx context.Context, userID int64, password string) (Session, error) {
-	if s.password != "" && s.password != password {
+	if s.isLocked(userID) {
+		return Session{}, ErrTooManyAttempts
+	}
+
+	role, ok := s.matchRole(password)
+	if !ok {
+		s.registerFailure(userID)
 		return Session{}, ErrUnauthorized
 	}
+	s.resetFailures(userID)
 
 	expiresAt := time.Time{}
 	if s.ttl > 0 {
-		expiresAt = time.Now().Add(s.ttl)
+		expiresAt = s.now().Add(s.ttl)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return Session{}, fmt.Errorf("generate token: %w", err)
 	}
 
 	session := Session{
 		UserID:    userID,
-		Token:     fmt.Sprintf("tok_%d_%d", userID, time.Now().UnixNano()),
+		Token:     token,
 		ExpiresAt: expiresAt,
+		Role:      role,
 	}
 	if err := s.store.Save(session); err != nil {
 		return Session{}, fmt.Errorf("save session: %w", err)
@@ -57,23 +160,168 @@ func (s *Service) Login(ctx context.Context, userID int64, password string) (Ses
 	return session, nil
 }
 
+func (s *Service) isLocked(userID int64) bool {
+	if s.maxAttempts <= 0 {
+		return false
+	}
+
+	s.attemptsMu.Lock()
+	defer s.attemptsMu.Unlock()
+
+	state, ok := s.attempts[userID]
+	if !ok || state.lockedUntil.IsZero() {
+		return false
+	}
+	if s.now().Before(state.lockedUntil) {
+		return true
+	}
+	// Блокировка истекла — начинаем отсчет попыток заново.
+	delete(s.attempts, userID)
+	return false
+}
+
+func (s *Service) registerFailure(userID int64) {
+	if s.maxAttempts <= 0 {
+		return
+	}
+
+	s.attemptsMu.Lock()
+	defer s.attemptsMu.Unlock()
+
+	state := s.attempts[userID]
+	state.failures++
+	if state.failures >= s.maxAttempts {
+		state.lockedUntil = s.now().Add(s.lockout)
+	}
+	s.attempts[userID] = state
+}
+
+func (s *Service) resetFailures(userID int64) {
+	s.attemptsMu.Lock()
+	defer s.attemptsMu.Unlock()
+
+	delete(s.attempts, userID)
+}
+
+// matchRole возвращает роль первого подходящего пароля.
+// Без настроенных паролей любой пароль дает обычный доступ: роль администратора
+// требует явно заданного пароля.
+func (s *Service) matchRole(password string) (Role, bool) {
+	if len(s.credentials) == 0 {
+		return RoleUser, true
+	}
+	for _, cred := range s.credentials {
+		if cred.PasswordHash != "" {
+			if bcrypt.CompareHashAndPassword([]byte(cred.PasswordHash), []byte(password)) == nil {
+				return cred.Role, true
+			}
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(cred.Password), []byte(password)) == 1 {
+			return cred.Role, true
+		}
+	}
+	return "", false
+}
+
+// newToken генерирует непредсказуемый токен сессии.
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
 func (s *Service) Logout(ctx context.Context, userID int64) {
 	s.store.Delete(userID)
 }
 
 func (s *Service) IsAuthorized(ctx context.Context, userID int64) bool {
-	session, ok := s.store.Get(userID)
+	_, ok := s.activeSession(userID)
+	return ok
+}
+
+// IsAuthorizedRole проверяет, что у пользователя есть действующая сессия с ролью role.
+// Администратору доступны все роли.
+func (s *Service) IsAuthorizedRole(ctx context.Context, userID int64, role Role) bool {
+	session, ok := s.activeSession(userID)
 	if !ok {
 		return false
 	}
+	sessionRole := session.Role
+	if sessionRole == "" {
+		sessionRole = RoleUser
+	}
+	return sessionRole == RoleAdmin || sessionRole == role
+}
+
+// AuthorizedUserIDs возвращает пользователей с действующей сессией. В отличие от
+// IsAuthorized не продлевает скользящие сессии: перебор не считается активностью.
+func (s *Service) AuthorizedUserIDs(ctx context.Context) ([]int64, error) {
+	ids, err := s.store.AllUserIDs()
+	if err != nil {
+		return nil, err
+	}
+	if s.ttl <= 0 {
+		return ids, nil
+	}
+
+	now := s.now()
+	active := ids[:0]
+	for _, id := range ids {
+		session, ok := s.store.Get(id)
+		if !ok || session.ExpiresAt.IsZero() || now.After(session.ExpiresAt) {
+			continue
+		}
+		active = append(active, id)
+	}
+	return active, nil
+}
+
+// Session возвращает действующую сессию пользователя без продления скользящего срока.
+func (s *Service) Session(ctx context.Context, userID int64) (Session, bool) {
+	session, ok := s.store.Get(userID)
+	if !ok {
+		return Session{}, false
+	}
+	if s.ttl > 0 && (session.ExpiresAt.IsZero() || s.now().After(session.ExpiresAt)) {
+		return Session{}, false
+	}
+	return session, true
+}
+
+// activeSession возвращает сессию, если она существует и не истекла; истекшую удаляет.
+func (s *Service) activeSession(userID int64) (Session, bool) {
+	session, ok := s.store.Get(userID)
+	if !ok {
+		return Session{}, false
+	}
 
 	// TTL == 0 означает, что сессии вечные и не истекают по времени.
 	if s.ttl <= 0 {
-		return true
+		return session, true
 	}
-	if session.ExpiresAt.IsZero() || time.Now().After(session.ExpiresAt) {
+	now := s.now()
+	if session.ExpiresAt.IsZero() || now.After(session.ExpiresAt) {
 		s.store.Delete(userID)
-		return false
+		return Session{}, false
+	}
+	if s.sliding {
+		session = s.extend(session, now)
+	}
+	return session, true
+}
+
+// extend сдвигает срок сессии на ttl от текущего момента. Чтобы не писать в хранилище
+// на каждое сообщение, новый срок сохраняется, только если он сдвинулся больше чем на десятую часть ttl.
+func (s *Service) extend(session Session, now time.Time) Session {
+	expiresAt := now.Add(s.ttl)
+	if expiresAt.Sub(session.ExpiresAt) < s.ttl/10 {
+		return session
 	}
-	return true
+	session.ExpiresAt = expiresAt
+	// Ошибка сохранения не лишает пользователя доступа: текущая сессия еще действительна.
+	_ = s.store.Save(session)
+	return session
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestServiceLoginAndLogout(t *testing.T) {
@@ -32,3 +34,150 @@ func TestServiceLoginAndLogout(t *testing.T) {
 		t.Fatalf("user should be logged out")
 	}
 }
+
+func TestServiceSessionDoesNotExtend(t *testing.T) {
+	store := NewMemoryStore()
+	service := NewServiceWithCredentials([]Credential{{Password: "secret", Role: RoleAdmin}}, time.Hour, store, WithSlidingExpiry())
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	if _, ok := service.Session(context.Background(), 42); ok {
+		t.Fatalf("expected no session before login")
+	}
+	if _, err := service.Login(context.Background(), 42, "secret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now = now.Add(30 * time.Minute)
+	session, ok := service.Session(context.Background(), 42)
+	if !ok || session.Role != RoleAdmin {
+		t.Fatalf("expected active admin session, got %+v %v", session, ok)
+	}
+	if want := time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC); !session.ExpiresAt.Equal(want) {
+		t.Fatalf("expected expiry to stay %v, got %v", want, session.ExpiresAt)
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := service.Session(context.Background(), 42); ok {
+		t.Fatalf("expected expired session to be hidden")
+	}
+}
+
+func TestServiceRoles(t *testing.T) {
+	store := NewMemoryStore()
+	service := NewServiceWithRoles(map[string]Role{
+		"root":  RoleAdmin,
+		"guest": RoleUser,
+	}, time.Hour, store)
+	ctx := context.Background()
+
+	admin, err := service.Login(ctx, 1, "root")
+	if err != nil {
+		t.Fatalf("admin login: %v", err)
+	}
+	if admin.Role != RoleAdmin {
+		t.Fatalf("expected admin role, got %q", admin.Role)
+	}
+
+	user, err := service.Login(ctx, 2, "guest")
+	if err != nil {
+		t.Fatalf("user login: %v", err)
+	}
+	if user.Role != RoleUser {
+		t.Fatalf("expected user role, got %q", user.Role)
+	}
+
+	if !service.IsAuthorizedRole(ctx, 1, RoleAdmin) || !service.IsAuthorizedRole(ctx, 1, RoleUser) {
+		t.Fatalf("admin should pass every role check")
+	}
+	if service.IsAuthorizedRole(ctx, 2, RoleAdmin) {
+		t.Fatalf("user must not pass admin check")
+	}
+	if !service.IsAuthorizedRole(ctx, 2, RoleUser) {
+		t.Fatalf("user should pass user check")
+	}
+	if service.IsAuthorizedRole(ctx, 3, RoleUser) {
+		t.Fatalf("unknown user must not be authorized")
+	}
+}
+
+func TestLegacySessionWithoutRoleIsUser(t *testing.T) {
+	store := NewMemoryStore()
+	service := NewService("secret", time.Hour, store)
+	if err := store.Save(Session{UserID: 5, Token: "tok", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+
+	if !service.IsAuthorizedRole(context.Background(), 5, RoleUser) {
+		t.Fatalf("legacy session should have user role")
+	}
+	if service.IsAuthorizedRole(context.Background(), 5, RoleAdmin) {
+		t.Fatalf("legacy session must not be admin")
+	}
+}
+
+func TestServiceBcryptPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hashed-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("generate hash: %v", err)
+	}
+	service := NewServiceWithCredentials([]Credential{
+		{PasswordHash: string(hash), Role: RoleAdmin},
+		{Password: "plain", Role: RoleUser},
+	}, time.Hour, NewMemoryStore())
+	ctx := context.Background()
+
+	if _, err := service.Login(ctx, 1, string(hash)); err == nil {
+		t.Fatalf("hash itself must not be accepted as password")
+	}
+	admin, err := service.Login(ctx, 1, "hashed-secret")
+	if err != nil {
+		t.Fatalf("hashed login: %v", err)
+	}
+	if admin.Role != RoleAdmin {
+		t.Fatalf("expected admin role, got %q", admin.Role)
+	}
+
+	user, err := service.Login(ctx, 2, "plain")
+	if err != nil {
+		t.Fatalf("plaintext login: %v", err)
+	}
+	if user.Role != RoleUser {
+		t.Fatalf("expected user role, got %q", user.Role)
+	}
+	if _, err := service.Login(ctx, 3, "wrong"); err == nil {
+		t.Fatalf("expected error on wrong password")
+	}
+}
+
+func TestSessionTokensAreRandom(t *testing.T) {
+	service := NewService("", time.Hour, NewMemoryStore())
+
+	first, err := service.Login(context.Background(), 1, "")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	second, err := service.Login(context.Background(), 1, "")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if len(first.Token) != 64 || first.Token == second.Token {
+		t.Fatalf("expected distinct 32-byte hex tokens, got %q and %q", first.Token, second.Token)
+	}
+}
+
+func TestNoCredentialsGrantsUserRole(t *testing.T) {
+	service := NewService("", time.Hour, NewMemoryStore())
+	ctx := context.Background()
+
+	session, err := service.Login(ctx, 1, "anything")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if session.Role != RoleUser {
+		t.Fatalf("expected user role without configured credentials, got %q", session.Role)
+	}
+	if service.IsAuthorizedRole(ctx, 1, RoleAdmin) {
+		t.Fatalf("expected admin access to require an explicit credential")
+	}
+}
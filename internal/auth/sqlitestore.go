@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations применяются по порядку; номер последней примененной хранится в PRAGMA user_version.
+var sqliteMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS sessions (
+		user_id    INTEGER NOT NULL,
+		token      TEXT    NOT NULL,
+		expires_at INTEGER NOT NULL DEFAULT 0,
+		role       TEXT    NOT NULL DEFAULT ''
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);`,
+}
+
+// SQLiteStore хранит сессии в таблице sessions базы SQLite.
+// expires_at хранится в наносекундах Unix, 0 означает бессрочную сессию.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore открывает базу по dsn (путь к файлу или ":memory:") и применяет миграции.
+func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("sqlite dsn is empty")
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	// SQLite сериализует запись, а ":memory:" живет в пределах одного соединения.
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLiteStore) Save(session Session) error {
+	_, err := s.db.Exec(`
+		INSERT INTO sessions (user_id, token, expires_at, role) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			token = excluded.token,
+			expires_at = excluded.expires_at,
+			role = excluded.role`,
+		session.UserID, session.Token, toUnixNano(session.ExpiresAt), string(session.Role))
+	if err != nil {
+		return fmt.Errorf("save session: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Get(userID int64) (Session, bool) {
+	var (
+		session   Session
+		expiresAt int64
+		role      string
+	)
+	err := s.db.QueryRow(`SELECT user_id, token, expires_at, role FROM sessions WHERE user_id = ?`, userID).
+		Scan(&session.UserID, &session.Token, &expiresAt, &role)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("sqlitestore: get session %d: %v", userID, err)
+		}
+		return Session{}, false
+	}
+	session.ExpiresAt = fromUnixNano(expiresAt)
+	session.Role = Role(role)
+	return session, true
+}
+
+// Delete удаляет сессию. Ошибка логируется, но не возвращается (интерфейс совместим с MemoryStore).
+func (s *SQLiteStore) Delete(userID int64) {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		log.Printf("sqlitestore: delete session %d: %v", userID, err)
+	}
+}
+
+func (s *SQLiteStore) AllUserIDs() ([]int64, error) {
+	rows, err := s.db.Query(`SELECT user_id FROM sessions ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *SQLiteStore) DeleteExpired(now time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at > 0 AND expires_at < ?`, now.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return int(removed), nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("begin migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", i+1, err)
+		}
+		// PRAGMA не поддерживает плейсхолдеры.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("set schema version %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("new sqlite store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteStoreSaveGetDelete(t *testing.T) {
+	store := newTestSQLiteStore(t)
+
+	original := Session{
+		UserID:    123,
+		Token:     "tok_123",
+		ExpiresAt: time.Now().Add(time.Hour),
+		Role:      RoleAdmin,
+	}
+	if err := store.Save(original); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+
+	loaded, ok := store.Get(original.UserID)
+	if !ok {
+		t.Fatalf("session not found")
+	}
+	if loaded.Token != original.Token || loaded.Role != original.Role {
+		t.Fatalf("unexpected session: %+v", loaded)
+	}
+	if !loaded.ExpiresAt.Equal(original.ExpiresAt) {
+		t.Fatalf("expires mismatch: got %v want %v", loaded.ExpiresAt, original.ExpiresAt)
+	}
+
+	updated := original
+	updated.Token = "tok_456"
+	updated.ExpiresAt = time.Time{}
+	if err := store.Save(updated); err != nil {
+		t.Fatalf("update session: %v", err)
+	}
+	loaded, _ = store.Get(original.UserID)
+	if loaded.Token != "tok_456" || !loaded.ExpiresAt.IsZero() {
+		t.Fatalf("expected upsert to replace session, got %+v", loaded)
+	}
+
+	store.Delete(original.UserID)
+	if _, ok := store.Get(original.UserID); ok {
+		t.Fatalf("session should be deleted")
+	}
+}
+
+func TestSQLiteStoreDeleteExpired(t *testing.T) {
+	store := newTestSQLiteStore(t)
+
+	now := time.Now()
+	_ = store.Save(Session{UserID: 1, Token: "expired", ExpiresAt: now.Add(-time.Minute)})
+	_ = store.Save(Session{UserID: 2, Token: "active", ExpiresAt: now.Add(time.Hour)})
+	_ = store.Save(Session{UserID: 3, Token: "forever"})
+
+	removed, err := store.DeleteExpired(now)
+	if err != nil {
+		t.Fatalf("delete expired: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 removed session, got %d", removed)
+	}
+	if _, ok := store.Get(1); ok {
+		t.Fatalf("expired session should be purged")
+	}
+	if _, ok := store.Get(3); !ok {
+		t.Fatalf("session without expiry should be kept")
+	}
+}
+
+func TestSQLiteStoreMigrationIsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.db")
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("new sqlite store: %v", err)
+	}
+	if err := store.Save(Session{UserID: 1, Token: "tok"}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	store.Close()
+
+	reopened, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopen sqlite store: %v", err)
+	}
+	defer reopened.Close()
+
+	if _, ok := reopened.Get(1); !ok {
+		t.Fatalf("session should survive reopen")
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// storeFactories создают каждую реализацию Store для общих тестов контракта.
+func storeFactories(t *testing.T) map[string]func() Store {
+	return map[string]func() Store{
+		"memory": func() Store { return NewMemoryStore() },
+		"file": func() Store {
+			store, err := NewFileStore(filepath.Join(t.TempDir(), "auth_sessions.json"))
+			if err != nil {
+				t.Fatalf("new filestore: %v", err)
+			}
+			return store
+		},
+		"batched file": func() Store {
+			store, err := NewBatchedFileStore(filepath.Join(t.TempDir(), "auth_sessions.json"), time.Hour)
+			if err != nil {
+				t.Fatalf("new batched filestore: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+		"sqlite": func() Store { return newTestSQLiteStore(t) },
+	}
+}
+
+func TestStoreAllUserIDs(t *testing.T) {
+	for name, newStore := range storeFactories(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore()
+
+			if ids, err := store.AllUserIDs(); err != nil || len(ids) != 0 {
+				t.Fatalf("expected empty store, got %v (err %v)", ids, err)
+			}
+
+			for _, id := range []int64{30, 10, 20} {
+				if err := store.Save(Session{UserID: id, Token: "tok"}); err != nil {
+					t.Fatalf("save %d: %v", id, err)
+				}
+			}
+			// Повторное сохранение не должно дублировать пользователя.
+			if err := store.Save(Session{UserID: 10, Token: "tok2"}); err != nil {
+				t.Fatalf("resave: %v", err)
+			}
+			store.Delete(20)
+
+			ids, err := store.AllUserIDs()
+			if err != nil {
+				t.Fatalf("all user ids: %v", err)
+			}
+			if want := []int64{10, 30}; !reflect.DeepEqual(ids, want) {
+				t.Fatalf("unexpected ids: got %v want %v", ids, want)
+			}
+		})
+	}
+}
+
+func TestAuthorizedUserIDsSkipsExpiredWithoutExtending(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	_ = store.Save(Session{UserID: 1, ExpiresAt: now.Add(time.Minute)})
+	_ = store.Save(Session{UserID: 2, ExpiresAt: now.Add(-time.Minute)})
+
+	service := NewServiceWithCredentials(nil, time.Hour, store, WithSlidingExpiry())
+	service.now = func() time.Time { return now }
+
+	ids, err := service.AuthorizedUserIDs(context.Background())
+	if err != nil {
+		t.Fatalf("authorized user ids: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int64{1}) {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+	if session, _ := store.Get(1); !session.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("enumeration must not extend sliding sessions, got %v", session.ExpiresAt)
+	}
+}
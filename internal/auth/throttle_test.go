@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginLockoutAndRecovery(t *testing.T) {
+	now := time.Now()
+	service := NewServiceWithCredentials([]Credential{{Password: "secret", Role: RoleAdmin}}, time.Hour, NewMemoryStore(),
+		WithLoginThrottle(3, 10*time.Minute))
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.Login(ctx, 1, "wrong"); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("attempt %d: expected ErrUnauthorized, got %v", i+1, err)
+		}
+	}
+
+	if _, err := service.Login(ctx, 1, "secret"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected lockout even with correct password, got %v", err)
+	}
+	if _, err := service.Login(ctx, 2, "secret"); err != nil {
+		t.Fatalf("lockout must be per user, got %v", err)
+	}
+
+	now = now.Add(11 * time.Minute)
+	if _, err := service.Login(ctx, 1, "secret"); err != nil {
+		t.Fatalf("expected login after lockout expiry, got %v", err)
+	}
+}
+
+func TestSuccessfulLoginResetsFailures(t *testing.T) {
+	service := NewServiceWithCredentials([]Credential{{Password: "secret", Role: RoleAdmin}}, time.Hour, NewMemoryStore(),
+		WithLoginThrottle(2, time.Minute))
+	ctx := context.Background()
+
+	if _, err := service.Login(ctx, 1, "wrong"); err == nil {
+		t.Fatalf("expected error on wrong password")
+	}
+	if _, err := service.Login(ctx, 1, "secret"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if _, err := service.Login(ctx, 1, "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("counter should restart after success, got %v", err)
+	}
+	if _, err := service.Login(ctx, 1, "secret"); err != nil {
+		t.Fatalf("user should not be locked after a single new failure: %v", err)
+	}
+}
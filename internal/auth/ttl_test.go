@@ -64,3 +64,75 @@ func TestTTLRemovesExpiredSessions(t *testing.T) {
 		t.Fatalf("expired session should be removed from persisted file")
 	}
 }
+
+func TestFixedExpiryIgnoresActivity(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	service := NewServiceWithCredentials(nil, time.Hour, store)
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := service.Login(ctx, 1, ""); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	now = now.Add(50 * time.Minute)
+	if !service.IsAuthorized(ctx, 1) {
+		t.Fatalf("session should still be valid")
+	}
+	now = now.Add(20 * time.Minute)
+	if service.IsAuthorized(ctx, 1) {
+		t.Fatalf("fixed session must expire ttl after login despite activity")
+	}
+}
+
+func TestSlidingExpiryRenewsOnActivity(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "auth_sessions.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("new filestore: %v", err)
+	}
+
+	now := time.Now()
+	service := NewServiceWithCredentials(nil, time.Hour, store, WithSlidingExpiry())
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := service.Login(ctx, 1, ""); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	original, _ := store.Get(1)
+
+	// Небольшой сдвиг не должен приводить к записи на диск.
+	now = now.Add(time.Minute)
+	if !service.IsAuthorized(ctx, 1) {
+		t.Fatalf("session should be valid")
+	}
+	if got, _ := store.Get(1); !got.ExpiresAt.Equal(original.ExpiresAt) {
+		t.Fatalf("small extension must not be persisted")
+	}
+
+	now = now.Add(49 * time.Minute)
+	if !service.IsAuthorized(ctx, 1) {
+		t.Fatalf("session should be valid")
+	}
+	now = now.Add(50 * time.Minute)
+	if !service.IsAuthorized(ctx, 1) {
+		t.Fatalf("sliding session should be renewed by activity")
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reload filestore: %v", err)
+	}
+	persisted, ok := reloaded.Get(1)
+	if !ok || !persisted.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expected renewed expiry to be persisted, got %v", persisted.ExpiresAt)
+	}
+
+	now = now.Add(61 * time.Minute)
+	if service.IsAuthorized(ctx, 1) {
+		t.Fatalf("idle sliding session must expire")
+	}
+}
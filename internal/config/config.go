@@ -1,40 +1,126 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
-	HTTPAddr       string
-	LogLevel       string
-	AdminPassword  string
-	SessionTTL     time.Duration
-	AuthStorePath  string
-	AuthStoreType  string
-	RequestTimeout time.Duration
-	OpenRouter     OpenRouterConfig
-	Telegram       TelegramConfig
+	HTTPAddr string
+	// HTTPReadTimeout, HTTPWriteTimeout и HTTPIdleTimeout ограничивают чтение запроса,
+	// запись ответа и простой keep-alive соединения. На фоновую работу с LLM не влияют:
+	// вебхук отвечает сразу, а update обрабатывается уже после ответа.
+	HTTPReadTimeout  time.Duration
+	HTTPWriteTimeout time.Duration
+	HTTPIdleTimeout  time.Duration
+	// ShutdownTimeout сколько ждать завершения активных запросов при остановке.
+	ShutdownTimeout time.Duration
+	LogLevel        string
+	// DemoMode разрешает запуск без токенов и паролей — для локальной проверки.
+	DemoMode               bool
+	AdminPasswordHash      string
+	AdminPassword          string
+	AuthCredentials        map[string]string
+	LoginMaxAttempts       int
+	LoginLockout           time.Duration
+	SessionTTL             time.Duration
+	SessionExpiryMode      string
+	AuthStorePath          string
+	AuthStoreFlushInterval time.Duration
+	AuthStoreType          string
+	// AuthCleanupInterval период фоновой очистки истекших сессий; 0 — очистка отключена.
+	AuthCleanupInterval time.Duration
+	RequestTimeout      time.Duration
+	HealthCacheTTL      time.Duration
+	MaxWorkers          int
+	ProcessingTimeout   time.Duration
+	AcquireTimeout      time.Duration
+	// AskLanguageHint просит модель отвечать на языке пользователя из Telegram.
+	AskLanguageHint bool
+	AskMemory       bool
+	Dialog          DialogConfig
+	LLMProvider     string
+	// LLMCacheSize включает кэш ответов LLM на столько записей; 0 — кэш выключен.
+	LLMCacheSize int
+	LLMCacheTTL  time.Duration
+	// LLMFallbackModels модели, которые пробуются по очереди, если основная вернула ошибку.
+	LLMFallbackModels []string
+	OpenRouter        OpenRouterConfig
+	Anthropic         AnthropicConfig
+	Telegram          TelegramConfig
+}
+
+// DialogConfig настройки хранения и отправки истории диалогов.
+type DialogConfig struct {
+	TTL        time.Duration
+	MaxHistory int
+	// SummarizeThreshold включает сворачивание старых реплик; 0 — выключено.
+	SummarizeThreshold int
+	SummarizeKeep      int
+	// MaxCount ограничивает число хранимых диалогов; 0 — без ограничения.
+	MaxCount int
 }
 
 type OpenRouterConfig struct {
 	APIKey       string
 	BaseURL      string
 	DefaultModel string
+	// AppURL и AppName уходят в заголовках HTTP-Referer и X-Title для атрибуции приложения.
+	AppURL  string
+	AppName string
+	// ProviderOrder, AllowFallbacks и RequireParameters задают поле provider запроса
+	// (маршрутизация по upstream-провайдерам). Пустые значения не отправляются.
+	ProviderOrder     []string
+	AllowFallbacks    *bool
+	RequireParameters *bool
+	// RetryCount сколько раз повторять запрос после временной ошибки (429, 5xx);
+	// пауза перед n-м повтором — n*RetryBackoff.
+	RetryCount   int
+	RetryBackoff time.Duration
+	// ShowReasoning показывает пользователю рассуждения моделей вроде o1 и deepseek-r1.
+	ShowReasoning bool
+}
+
+type AnthropicConfig struct {
+	APIKey       string
+	BaseURL      string
+	DefaultModel string
+	MaxTokens    int
+	// RetryCount и RetryBackoff работают так же, как у OpenRouter: повторы после 429, 529 и 5xx,
+	// пауза перед n-м повтором — n*RetryBackoff.
+	RetryCount   int
+	RetryBackoff time.Duration
 }
 
 type TelegramConfig struct {
 	BotToken      string
 	APIBaseURL    string
 	WebhookSecret string
+	// WebhookURL публичный адрес вебхука; если задан, он регистрируется через setWebhook при старте.
+	WebhookURL string
+	// AllowedChatIDs белый список чатов; пустой список — бот доступен из любого чата.
+	AllowedChatIDs []int64
+	// MaxBodyBytes лимит тела запроса вебхука в байтах.
+	MaxBodyBytes int64
+	// DedupWindow окно отбрасывания повторных доставок одного update_id; 0 — отключено.
+	DedupWindow time.Duration
 }
 
 func Load() (Config, error) {
 	var cfg Config
 
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadEnvFile(path); err != nil {
+			return Config{}, fmt.Errorf("load CONFIG_FILE %s: %w", path, err)
+		}
+	}
+
 	port := os.Getenv("PORT")
 	if port != "" {
 		cfg.HTTPAddr = ":" + port
@@ -42,8 +128,62 @@ func Load() (Config, error) {
 		cfg.HTTPAddr = getEnv("HTTP_ADDR", ":8080")
 	}
 
+	readTimeout, err := parseDuration(getEnv("HTTP_READ_TIMEOUT", "15s"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse HTTP_READ_TIMEOUT: %w", err)
+	}
+	cfg.HTTPReadTimeout = readTimeout
+
+	writeTimeout, err := parseDuration(getEnv("HTTP_WRITE_TIMEOUT", "15s"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse HTTP_WRITE_TIMEOUT: %w", err)
+	}
+	cfg.HTTPWriteTimeout = writeTimeout
+
+	idleTimeout, err := parseDuration(getEnv("HTTP_IDLE_TIMEOUT", "60s"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse HTTP_IDLE_TIMEOUT: %w", err)
+	}
+	cfg.HTTPIdleTimeout = idleTimeout
+
+	shutdownTimeout, err := parsePositiveDuration(getEnv("SHUTDOWN_TIMEOUT", "10s"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse SHUTDOWN_TIMEOUT: %w", err)
+	}
+	cfg.ShutdownTimeout = shutdownTimeout
+
 	cfg.LogLevel = getEnv("LOG_LEVEL", "info")
+
+	demoMode, err := parseBoolDefault(getEnv("DEMO_MODE", ""), false)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse DEMO_MODE: %w", err)
+	}
+	cfg.DemoMode = demoMode
 	cfg.AdminPassword = getEnv("ADMIN_PASSWORD", "")
+	cfg.AdminPasswordHash = getEnv("ADMIN_PASSWORD_HASH", "")
+	if cfg.AdminPasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(cfg.AdminPasswordHash)); err != nil {
+			return Config{}, fmt.Errorf("parse ADMIN_PASSWORD_HASH: %w", err)
+		}
+	}
+
+	loginMaxAttempts, err := parseIntDefault(getEnv("LOGIN_MAX_ATTEMPTS", ""), 5)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse LOGIN_MAX_ATTEMPTS: %w", err)
+	}
+	cfg.LoginMaxAttempts = loginMaxAttempts
+
+	loginLockout, err := parseDuration(getEnv("LOGIN_LOCKOUT", "15m"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse LOGIN_LOCKOUT: %w", err)
+	}
+	cfg.LoginLockout = loginLockout
+
+	credentials, err := parseCredentials(getEnv("AUTH_CREDENTIALS", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse AUTH_CREDENTIALS: %w", err)
+	}
+	cfg.AuthCredentials = credentials
 
 	sessionTTL, err := parseDuration(getEnv("SESSION_TTL", "2h"))
 	if err != nil {
@@ -51,25 +191,218 @@ func Load() (Config, error) {
 	}
 	cfg.SessionTTL = sessionTTL
 
+	cfg.SessionExpiryMode = strings.ToLower(getEnv("SESSION_EXPIRY_MODE", "fixed"))
+	switch cfg.SessionExpiryMode {
+	case "fixed", "sliding":
+	default:
+		return Config{}, fmt.Errorf("unknown SESSION_EXPIRY_MODE %q", cfg.SessionExpiryMode)
+	}
+
 	cfg.AuthStorePath = getEnv("AUTH_STORE_PATH", "/data/auth_sessions.json")
 	cfg.AuthStoreType = strings.ToLower(getEnv("AUTH_STORE_TYPE", "file"))
 
+	flushInterval, err := parseDuration(getEnv("AUTH_STORE_FLUSH_INTERVAL", "0"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse AUTH_STORE_FLUSH_INTERVAL: %w", err)
+	}
+	cfg.AuthStoreFlushInterval = flushInterval
+
+	cleanupInterval, err := parseDuration(getEnv("AUTH_CLEANUP_INTERVAL", "10m"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse AUTH_CLEANUP_INTERVAL: %w", err)
+	}
+	cfg.AuthCleanupInterval = cleanupInterval
+
 	reqTimeout, err := parseDuration(getEnv("HTTP_CLIENT_TIMEOUT", "15s"))
 	if err != nil {
 		return Config{}, fmt.Errorf("parse HTTP_CLIENT_TIMEOUT: %w", err)
 	}
 	cfg.RequestTimeout = reqTimeout
 
+	healthTTL, err := parseDuration(getEnv("HEALTH_CACHE_TTL", "30s"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse HEALTH_CACHE_TTL: %w", err)
+	}
+	cfg.HealthCacheTTL = healthTTL
+
+	maxWorkers, err := parseIntDefault(getEnv("MAX_WORKERS", ""), 10)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse MAX_WORKERS: %w", err)
+	}
+	if maxWorkers <= 0 {
+		return Config{}, fmt.Errorf("MAX_WORKERS must be positive, got %d", maxWorkers)
+	}
+	cfg.MaxWorkers = maxWorkers
+
+	processingTimeout, err := parsePositiveDuration(getEnv("PROCESSING_TIMEOUT", "60s"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse PROCESSING_TIMEOUT: %w", err)
+	}
+	cfg.ProcessingTimeout = processingTimeout
+
+	acquireTimeout, err := parsePositiveDuration(getEnv("ACQUIRE_TIMEOUT", "200ms"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse ACQUIRE_TIMEOUT: %w", err)
+	}
+	cfg.AcquireTimeout = acquireTimeout
+
+	askMemory, err := parseBoolDefault(getEnv("ASK_MEMORY", ""), false)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse ASK_MEMORY: %w", err)
+	}
+	cfg.AskMemory = askMemory
+
+	askLanguageHint, err := parseBoolDefault(getEnv("ASK_LANGUAGE_HINT", ""), false)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse ASK_LANGUAGE_HINT: %w", err)
+	}
+	cfg.AskLanguageHint = askLanguageHint
+
+	dialogTTL, err := parseDuration(getEnv("DIALOG_TTL", "1h"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse DIALOG_TTL: %w", err)
+	}
+	cfg.Dialog.TTL = dialogTTL
+
+	dialogMaxHistory, err := parseIntDefault(getEnv("DIALOG_MAX_HISTORY", ""), 40)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse DIALOG_MAX_HISTORY: %w", err)
+	}
+	if dialogMaxHistory < 0 {
+		return Config{}, fmt.Errorf("DIALOG_MAX_HISTORY must not be negative, got %d", dialogMaxHistory)
+	}
+	cfg.Dialog.MaxHistory = dialogMaxHistory
+
+	summarizeThreshold, err := parseIntDefault(getEnv("DIALOG_SUMMARIZE_THRESHOLD", ""), 0)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse DIALOG_SUMMARIZE_THRESHOLD: %w", err)
+	}
+	cfg.Dialog.SummarizeThreshold = summarizeThreshold
+
+	summarizeKeep, err := parseIntDefault(getEnv("DIALOG_SUMMARIZE_KEEP", ""), 10)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse DIALOG_SUMMARIZE_KEEP: %w", err)
+	}
+	cfg.Dialog.SummarizeKeep = summarizeKeep
+
+	dialogMaxCount, err := parseIntDefault(getEnv("DIALOG_MAX_COUNT", ""), 0)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse DIALOG_MAX_COUNT: %w", err)
+	}
+	if dialogMaxCount < 0 {
+		return Config{}, fmt.Errorf("DIALOG_MAX_COUNT must not be negative, got %d", dialogMaxCount)
+	}
+	cfg.Dialog.MaxCount = dialogMaxCount
+
+	allowFallbacks, err := parseOptionalBool(getEnv("OPENROUTER_ALLOW_FALLBACKS", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse OPENROUTER_ALLOW_FALLBACKS: %w", err)
+	}
+	requireParameters, err := parseOptionalBool(getEnv("OPENROUTER_REQUIRE_PARAMETERS", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse OPENROUTER_REQUIRE_PARAMETERS: %w", err)
+	}
+	openRouterRetryCount, err := parseIntDefault(getEnv("OPENROUTER_RETRY_COUNT", ""), 2)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse OPENROUTER_RETRY_COUNT: %w", err)
+	}
+	if openRouterRetryCount < 0 {
+		return Config{}, fmt.Errorf("OPENROUTER_RETRY_COUNT must not be negative, got %d", openRouterRetryCount)
+	}
+	openRouterBackoff, err := parseDuration(getEnv("OPENROUTER_RETRY_BACKOFF", "500ms"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse OPENROUTER_RETRY_BACKOFF: %w", err)
+	}
+	if openRouterBackoff < 0 {
+		return Config{}, fmt.Errorf("OPENROUTER_RETRY_BACKOFF must not be negative, got %s", openRouterBackoff)
+	}
+	showReasoning, err := parseBoolDefault(getEnv("OPENROUTER_SHOW_REASONING", ""), false)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse OPENROUTER_SHOW_REASONING: %w", err)
+	}
 	cfg.OpenRouter = OpenRouterConfig{
 		APIKey:       getEnv("OPENROUTER_API_KEY", ""),
 		BaseURL:      getEnv("OPENROUTER_BASE_URL", "https://openrouter.ai/api/v1"),
 		DefaultModel: getEnv("OPENROUTER_DEFAULT_MODEL", ""),
+		AppURL:       getEnv("OPENROUTER_APP_URL", ""),
+		AppName:      getEnv("OPENROUTER_APP_NAME", ""),
+
+		ProviderOrder:     parseList(getEnv("OPENROUTER_PROVIDER_ORDER", "")),
+		AllowFallbacks:    allowFallbacks,
+		RequireParameters: requireParameters,
+		RetryCount:        openRouterRetryCount,
+		RetryBackoff:      openRouterBackoff,
+		ShowReasoning:     showReasoning,
+	}
+
+	cfg.LLMProvider = strings.ToLower(getEnv("LLM_PROVIDER", "openrouter"))
+	switch cfg.LLMProvider {
+	case "openrouter", "anthropic":
+	default:
+		return Config{}, fmt.Errorf("unknown LLM_PROVIDER %q", cfg.LLMProvider)
+	}
+
+	cacheSize, err := parseIntDefault(getEnv("LLM_CACHE_SIZE", ""), 0)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse LLM_CACHE_SIZE: %w", err)
+	}
+	cfg.LLMCacheSize = cacheSize
+
+	cacheTTL, err := parseDuration(getEnv("LLM_CACHE_TTL", "10m"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse LLM_CACHE_TTL: %w", err)
 	}
+	cfg.LLMCacheTTL = cacheTTL
 
+	cfg.LLMFallbackModels = parseList(getEnv("LLM_FALLBACK_MODELS", ""))
+
+	anthropicMaxTokens, err := parseIntDefault(getEnv("ANTHROPIC_MAX_TOKENS", ""), 1024)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse ANTHROPIC_MAX_TOKENS: %w", err)
+	}
+	anthropicRetryCount, err := parseIntDefault(getEnv("ANTHROPIC_RETRY_COUNT", ""), 2)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse ANTHROPIC_RETRY_COUNT: %w", err)
+	}
+	if anthropicRetryCount < 0 {
+		return Config{}, fmt.Errorf("ANTHROPIC_RETRY_COUNT must not be negative, got %d", anthropicRetryCount)
+	}
+	anthropicBackoff, err := parseDuration(getEnv("ANTHROPIC_RETRY_BACKOFF", "500ms"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse ANTHROPIC_RETRY_BACKOFF: %w", err)
+	}
+	if anthropicBackoff < 0 {
+		return Config{}, fmt.Errorf("ANTHROPIC_RETRY_BACKOFF must not be negative, got %s", anthropicBackoff)
+	}
+	cfg.Anthropic = AnthropicConfig{
+		APIKey:       getEnv("ANTHROPIC_API_KEY", ""),
+		BaseURL:      getEnv("ANTHROPIC_BASE_URL", "https://api.anthropic.com/v1"),
+		DefaultModel: getEnv("ANTHROPIC_DEFAULT_MODEL", ""),
+		MaxTokens:    anthropicMaxTokens,
+		RetryCount:   anthropicRetryCount,
+		RetryBackoff: anthropicBackoff,
+	}
+
+	allowedChatIDs, err := parseIDList(getEnv("TELEGRAM_ALLOWED_CHAT_IDS", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse TELEGRAM_ALLOWED_CHAT_IDS: %w", err)
+	}
+	dedupWindow, err := parseDuration(getEnv("TELEGRAM_DEDUP_WINDOW", "10m"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse TELEGRAM_DEDUP_WINDOW: %w", err)
+	}
+	maxBodyBytes, err := parseIntDefault(getEnv("TELEGRAM_MAX_BODY_BYTES", ""), 256<<10)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse TELEGRAM_MAX_BODY_BYTES: %w", err)
+	}
 	cfg.Telegram = TelegramConfig{
-		BotToken:      getEnv("TELEGRAM_BOT_TOKEN", ""),
-		APIBaseURL:    getEnv("TELEGRAM_API_BASE_URL", "https://api.telegram.org"),
-		WebhookSecret: getEnv("TELEGRAM_WEBHOOK_SECRET", ""),
+		BotToken:       getEnv("TELEGRAM_BOT_TOKEN", ""),
+		APIBaseURL:     getEnv("TELEGRAM_API_BASE_URL", "https://api.telegram.org"),
+		WebhookSecret:  getEnv("TELEGRAM_WEBHOOK_SECRET", ""),
+		WebhookURL:     getEnv("WEBHOOK_URL", ""),
+		AllowedChatIDs: allowedChatIDs,
+		DedupWindow:    dedupWindow,
+		MaxBodyBytes:   int64(maxBodyBytes),
 	}
 
 	return cfg, nil
@@ -82,6 +415,111 @@ func parseDuration(value string) (time.Duration, error) {
 	return time.ParseDuration(value)
 }
 
+// parseCredentials parses "password:role,password:role" into password->role map.
+// Password may contain ':' — the role is taken after the last one.
+func parseCredentials(value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		idx := strings.LastIndex(pair, ":")
+		if idx <= 0 || idx == len(pair)-1 {
+			return nil, fmt.Errorf("invalid credential %q, expected password:role", pair)
+		}
+		role := strings.ToLower(pair[idx+1:])
+		if role != "admin" && role != "user" {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+		result[pair[:idx]] = role
+	}
+	return result, nil
+}
+
+// parseList splits comma-separated value, dropping empty items.
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseOptionalBool parses boolean that may be unset (nil).
+func parseOptionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// parseIDList parses comma-separated int64 ids, e.g. "123,-100456".
+func parseIDList(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", part, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Validate проверяет, что заданы значения, без которых сервис не сможет работать:
+// токен бота, ключ выбранного LLM-провайдера и хотя бы один пароль. В DemoMode
+// пустые значения допустимы.
+func (c Config) Validate() error {
+	if c.DemoMode {
+		return nil
+	}
+
+	var errs []error
+	if c.Telegram.BotToken == "" {
+		errs = append(errs, errors.New("TELEGRAM_BOT_TOKEN is required"))
+	}
+	switch c.LLMProvider {
+	case "anthropic":
+		if c.Anthropic.APIKey == "" {
+			errs = append(errs, errors.New("ANTHROPIC_API_KEY is required for LLM_PROVIDER=anthropic"))
+		}
+	default:
+		if c.OpenRouter.APIKey == "" {
+			errs = append(errs, errors.New("OPENROUTER_API_KEY is required for LLM_PROVIDER=openrouter"))
+		}
+	}
+	if c.AdminPassword == "" && c.AdminPasswordHash == "" && len(c.AuthCredentials) == 0 {
+		errs = append(errs, errors.New("ADMIN_PASSWORD, ADMIN_PASSWORD_HASH or AUTH_CREDENTIALS is required, otherwise any password grants admin"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config (set DEMO_MODE=true to run without it): %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// parsePositiveDuration parses duration that must be greater than zero.
+func parsePositiveDuration(value string) (time.Duration, error) {
+	d, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %s", d)
+	}
+	return d, nil
+}
+
 func getEnv(key, def string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return val
@@ -89,6 +527,14 @@ func getEnv(key, def string) string {
 	return def
 }
 
+// parseIntDefault parses optional integer with default value.
+func parseIntDefault(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
 // parseBoolDefault parses optional boolean with default value.
 func parseBoolDefault(value string, def bool) (bool, error) {
 	if value == "" {
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadWorkerPoolSettings(t *testing.T) {
+	t.Setenv("MAX_WORKERS", "3")
+	t.Setenv("PROCESSING_TIMEOUT", "90s")
+	t.Setenv("ACQUIRE_TIMEOUT", "1s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxWorkers != 3 {
+		t.Fatalf("unexpected max workers: %d", cfg.MaxWorkers)
+	}
+	if cfg.ProcessingTimeout != 90*time.Second {
+		t.Fatalf("unexpected processing timeout: %v", cfg.ProcessingTimeout)
+	}
+	if cfg.AcquireTimeout != time.Second {
+		t.Fatalf("unexpected acquire timeout: %v", cfg.AcquireTimeout)
+	}
+}
+
+func TestLoadHTTPServerTimeouts(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.HTTPReadTimeout != 15*time.Second || cfg.HTTPWriteTimeout != 15*time.Second || cfg.HTTPIdleTimeout != time.Minute {
+		t.Fatalf("unexpected default timeouts: %v %v %v", cfg.HTTPReadTimeout, cfg.HTTPWriteTimeout, cfg.HTTPIdleTimeout)
+	}
+
+	t.Setenv("HTTP_READ_TIMEOUT", "5s")
+	t.Setenv("HTTP_WRITE_TIMEOUT", "0")
+	t.Setenv("HTTP_IDLE_TIMEOUT", "2m")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.HTTPReadTimeout != 5*time.Second || cfg.HTTPWriteTimeout != 0 || cfg.HTTPIdleTimeout != 2*time.Minute {
+		t.Fatalf("unexpected timeouts: %v %v %v", cfg.HTTPReadTimeout, cfg.HTTPWriteTimeout, cfg.HTTPIdleTimeout)
+	}
+
+	t.Setenv("HTTP_WRITE_TIMEOUT", "soon")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for invalid HTTP_WRITE_TIMEOUT")
+	}
+}
+
+func TestLoadShutdownTimeout(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ShutdownTimeout != 10*time.Second {
+		t.Fatalf("unexpected default shutdown timeout: %v", cfg.ShutdownTimeout)
+	}
+
+	t.Setenv("SHUTDOWN_TIMEOUT", "2m")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ShutdownTimeout != 2*time.Minute {
+		t.Fatalf("unexpected shutdown timeout: %v", cfg.ShutdownTimeout)
+	}
+
+	t.Setenv("SHUTDOWN_TIMEOUT", "0s")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for non-positive SHUTDOWN_TIMEOUT")
+	}
+}
+
+func validConfig() Config {
+	return Config{
+		LLMProvider:   "openrouter",
+		AdminPassword: "secret",
+		OpenRouter:    OpenRouterConfig{APIKey: "key"},
+		Telegram:      TelegramConfig{BotToken: "token"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := map[string]struct {
+		mutate func(*Config)
+		want   string
+	}{
+		"missing bot token": {
+			mutate: func(c *Config) { c.Telegram.BotToken = "" },
+			want:   "TELEGRAM_BOT_TOKEN",
+		},
+		"missing openrouter key": {
+			mutate: func(c *Config) { c.OpenRouter.APIKey = "" },
+			want:   "OPENROUTER_API_KEY",
+		},
+		"missing anthropic key": {
+			mutate: func(c *Config) { c.LLMProvider = "anthropic" },
+			want:   "ANTHROPIC_API_KEY",
+		},
+		"missing password": {
+			mutate: func(c *Config) { c.AdminPassword = "" },
+			want:   "ADMIN_PASSWORD",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			tc.mutate(&cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error mentioning %s, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateDemoModeAllowsEmptyValues(t *testing.T) {
+	t.Setenv("DEMO_MODE", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.DemoMode {
+		t.Fatalf("expected demo mode to be enabled")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error in demo mode: %v", err)
+	}
+}
+
+func TestLoadOpenRouterRetrySettings(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OpenRouter.RetryCount != 2 || cfg.OpenRouter.RetryBackoff != 500*time.Millisecond {
+		t.Fatalf("unexpected defaults: %d %v", cfg.OpenRouter.RetryCount, cfg.OpenRouter.RetryBackoff)
+	}
+
+	t.Setenv("OPENROUTER_RETRY_COUNT", "0")
+	t.Setenv("OPENROUTER_RETRY_BACKOFF", "2s")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OpenRouter.RetryCount != 0 || cfg.OpenRouter.RetryBackoff != 2*time.Second {
+		t.Fatalf("unexpected retry settings: %d %v", cfg.OpenRouter.RetryCount, cfg.OpenRouter.RetryBackoff)
+	}
+
+	t.Setenv("OPENROUTER_RETRY_COUNT", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for negative OPENROUTER_RETRY_COUNT")
+	}
+	t.Setenv("OPENROUTER_RETRY_COUNT", "1")
+	t.Setenv("OPENROUTER_RETRY_BACKOFF", "-1s")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for negative OPENROUTER_RETRY_BACKOFF")
+	}
+}
+
+func TestLoadAnthropicRetrySettings(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Anthropic.RetryCount != 2 || cfg.Anthropic.RetryBackoff != 500*time.Millisecond {
+		t.Fatalf("unexpected defaults: %d %v", cfg.Anthropic.RetryCount, cfg.Anthropic.RetryBackoff)
+	}
+
+	t.Setenv("ANTHROPIC_RETRY_COUNT", "5")
+	t.Setenv("ANTHROPIC_RETRY_BACKOFF", "1s")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Anthropic.RetryCount != 5 || cfg.Anthropic.RetryBackoff != time.Second {
+		t.Fatalf("unexpected retry settings: %d %v", cfg.Anthropic.RetryCount, cfg.Anthropic.RetryBackoff)
+	}
+
+	t.Setenv("ANTHROPIC_RETRY_COUNT", "-1")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for negative ANTHROPIC_RETRY_COUNT")
+	}
+	t.Setenv("ANTHROPIC_RETRY_COUNT", "1")
+	t.Setenv("ANTHROPIC_RETRY_BACKOFF", "-1s")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for negative ANTHROPIC_RETRY_BACKOFF")
+	}
+}
+
+func TestLoadAuthCredentials(t *testing.T) {
+	t.Setenv("AUTH_CREDENTIALS", "root:pw:admin, guest:user")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AuthCredentials["root:pw"] != "admin" || cfg.AuthCredentials["guest"] != "user" {
+		t.Fatalf("unexpected credentials: %v", cfg.AuthCredentials)
+	}
+
+	t.Setenv("AUTH_CREDENTIALS", "guest:owner")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for unknown role")
+	}
+}
+
+func TestLoadAllowedChatIDs(t *testing.T) {
+	t.Setenv("TELEGRAM_ALLOWED_CHAT_IDS", "42, -100123")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids := cfg.Telegram.AllowedChatIDs
+	if len(ids) != 2 || ids[0] != 42 || ids[1] != -100123 {
+		t.Fatalf("unexpected allowed chat ids: %v", ids)
+	}
+
+	t.Setenv("TELEGRAM_ALLOWED_CHAT_IDS", "42,abc")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for invalid chat id")
+	}
+}
+
+func TestLoadRejectsInvalidPasswordHash(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD_HASH", "not-a-bcrypt-hash")
+
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for invalid ADMIN_PASSWORD_HASH")
+	}
+}
+
+func TestLoadRejectsNonPositiveWorkerPoolSettings(t *testing.T) {
+	cases := map[string]string{
+		"MAX_WORKERS":        "0",
+		"PROCESSING_TIMEOUT": "0s",
+		"ACQUIRE_TIMEOUT":    "-1s",
+	}
+	for key, value := range cases {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s", key, value)
+			}
+		})
+	}
+}
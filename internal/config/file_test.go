@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFromConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.env")
+	content := `# локальная разработка
+LOG_LEVEL=debug
+export TELEGRAM_BOT_TOKEN="file-token"
+MAX_WORKERS='4'
+
+HTTP_ADDR=:9000
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	for _, key := range []string{"LOG_LEVEL", "TELEGRAM_BOT_TOKEN", "MAX_WORKERS"} {
+		unsetEnv(t, key)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("HTTP_ADDR", ":7000")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LogLevel != "debug" || cfg.Telegram.BotToken != "file-token" || cfg.MaxWorkers != 4 {
+		t.Fatalf("values from file not applied: %+v", cfg)
+	}
+	if cfg.HTTPAddr != ":7000" {
+		t.Fatalf("environment must take precedence over file, got %q", cfg.HTTPAddr)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.env"))
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for missing config file")
+	}
+
+	path := filepath.Join(t.TempDir(), "broken.env")
+	if err := os.WriteFile(path, []byte("NOT A PAIR\n"), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for malformed line")
+	}
+}
+
+// unsetEnv убирает переменную на время теста и восстанавливает прежнее значение.
+func unsetEnv(t *testing.T, key string) {
+	t.Helper()
+	prev, ok := os.LookupEnv(key)
+	os.Unsetenv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheTTL     = 30 * time.Second
+	defaultProbeTimeout = 5 * time.Second
+)
+
+// Probe проверяет доступность одной внешней зависимости.
+type Probe func(ctx context.Context) error
+
+type namedProbe struct {
+	name  string
+	probe Probe
+}
+
+// CheckResult результат проверки одной зависимости.
+type CheckResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report сводный результат проверки всех зависимостей.
+type Report struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checked_at"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+// Healthy сообщает, прошли ли все проверки.
+func (r Report) Healthy() bool {
+	for _, check := range r.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// Checker выполняет проверки зависимостей и кеширует результат на ttl,
+// чтобы частые запросы балансировщика не нагружали внешние API.
+type Checker struct {
+	ttl          time.Duration
+	probeTimeout time.Duration
+	probes       []namedProbe
+
+	mu        sync.Mutex
+	last      Report
+	hasResult bool
+}
+
+func NewChecker(ttl time.Duration) *Checker {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &Checker{
+		ttl:          ttl,
+		probeTimeout: defaultProbeTimeout,
+	}
+}
+
+// Register добавляет проверку зависимости под заданным именем.
+func (c *Checker) Register(name string, probe Probe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.probes = append(c.probes, namedProbe{name: name, probe: probe})
+	c.hasResult = false
+}
+
+// Check возвращает закешированный отчет или выполняет проверки заново, если кеш устарел.
+// Проверки выполняются под мьютексом, поэтому одновременные запросы не дублируют обращения к API.
+// Отмена ctx на них не влияет: результат кешируется для всех, и отключившийся клиент
+// не должен оставить в кеше ложный сбой. Каждая проверка ограничена probeTimeout.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hasResult && time.Since(c.last.CheckedAt) < c.ttl {
+		return c.last
+	}
+
+	report := Report{
+		CheckedAt: time.Now(),
+		Checks:    make(map[string]CheckResult, len(c.probes)),
+	}
+	for _, p := range c.probes {
+		probeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.probeTimeout)
+		err := p.probe(probeCtx)
+		cancel()
+
+		result := CheckResult{OK: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		report.Checks[p.name] = result
+	}
+
+	report.Status = "ok"
+	if !report.Healthy() {
+		report.Status = "unavailable"
+	}
+
+	c.last = report
+	c.hasResult = true
+	return report
+}
+
+// ServeHTTP отдает отчет в JSON: 200, если все зависимости доступны, иначе 503.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckerCachesProbeResult(t *testing.T) {
+	calls := 0
+	checker := NewChecker(time.Minute)
+	checker.Register("telegram", func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		checker.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected probe to run once within ttl, got %d", calls)
+	}
+}
+
+func TestCheckerReportsFailingDependency(t *testing.T) {
+	checker := NewChecker(time.Nanosecond)
+	checker.Register("telegram", func(ctx context.Context) error { return nil })
+	checker.Register("llm", func(ctx context.Context) error { return errors.New("last call failed") })
+
+	rr := httptest.NewRecorder()
+	checker.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", rr.Code)
+	}
+
+	report := checker.Check(context.Background())
+	if report.Checks["llm"].OK {
+		t.Fatalf("expected llm check to fail")
+	}
+	if !report.Checks["telegram"].OK {
+		t.Fatalf("expected telegram check to pass")
+	}
+}
+
+func TestCheckerIgnoresCallerCancellation(t *testing.T) {
+	checker := NewChecker(time.Minute)
+	checker.Register("telegram", func(ctx context.Context) error { return ctx.Err() })
+
+	// Клиент health-check отключился до проверки.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := checker.Check(ctx); !report.Healthy() {
+		t.Fatalf("expected probe to run despite caller cancellation, got %+v", report)
+	}
+	if report := checker.Check(context.Background()); !report.Healthy() {
+		t.Fatalf("expected cached result to be healthy, got %+v", report)
+	}
+}
@@ -13,6 +13,8 @@ import (
 type RouterDeps struct {
 	Logger          *slog.Logger
 	TelegramHandler http.Handler
+	// HealthHandler отвечает на /healthz; если не задан, эндпоинт не регистрируется.
+	HealthHandler http.Handler
 }
 
 // NewRouter собирает chi-роутер с общими middleware.
@@ -28,6 +30,10 @@ func NewRouter(deps RouterDeps) http.Handler {
 		w.Write([]byte("pong"))
 	})
 
+	if deps.HealthHandler != nil {
+		r.Get("/healthz", deps.HealthHandler.ServeHTTP)
+	}
+
 	r.Post("/telegram/webhook", deps.TelegramHandler.ServeHTTP)
 
 	return r
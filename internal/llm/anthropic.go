@@ -0,0 +1,161 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"aiadvent/internal/config"
+)
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 1024
+	// anthropicStatusOverloaded Anthropic отвечает 529, когда API перегружен.
+	anthropicStatusOverloaded = 529
+)
+
+// AnthropicClient клиент Anthropic Messages API, альтернатива OpenRouter.
+type AnthropicClient struct {
+	apiKey       string
+	baseURL      string
+	defaultModel string
+	maxTokens    int
+	httpClient   *http.Client
+	retryCount   int
+	backoff      time.Duration
+	logger       *slog.Logger
+}
+
+func NewAnthropicClient(cfg config.AnthropicConfig, httpClient *http.Client, logger *slog.Logger) Client {
+	maxTokens := cfg.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
+	return &AnthropicClient{
+		apiKey:       cfg.APIKey,
+		baseURL:      cfg.BaseURL,
+		defaultModel: cfg.DefaultModel,
+		maxTokens:    maxTokens,
+		httpClient:   httpClient,
+		retryCount:   cfg.RetryCount,
+		backoff:      cfg.RetryBackoff,
+		logger:       logger,
+	}
+}
+
+func (c *AnthropicClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return c.ChatWithMessages(ctx, model, []Message{
+		{Role: RoleUser, Content: prompt},
+	})
+}
+
+// ChatWithMessages отправляет историю в Messages API. Системные сообщения
+// передаются отдельным полем system, так как API не принимает роль system в messages.
+// Маршрутизация провайдеров (WithProvider) есть только у OpenRouter и здесь игнорируется.
+func (c *AnthropicClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	if model == "" {
+		model = c.defaultModel
+	}
+	if model == "" {
+		return "", ErrInvalidModel
+	}
+
+	params := applyChatOptions(opts)
+	requestBody := anthropicRequest{
+		Model:       model,
+		MaxTokens:   c.maxTokens,
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+	}
+	if params.MaxTokens != nil {
+		requestBody.MaxTokens = *params.MaxTokens
+	}
+	var system []string
+	for _, msg := range messages {
+		if msg.Role == RoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		requestBody.Messages = append(requestBody.Messages, msg)
+	}
+	requestBody.System = strings.Join(system, "\n\n")
+
+	return withRetries(ctx, c.retryCount, c.backoff, c.logger, "anthropic", func() (string, error) {
+		return c.doRequest(ctx, requestBody)
+	})
+}
+
+func (c *AnthropicClient) doRequest(ctx context.Context, body anthropicRequest) (string, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/messages", c.baseURL), bytes.NewReader(buf))
+	if err != nil {
+		return "", fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", anthropicVersion)
+	if c.apiKey != "" {
+		req.Header.Set("x-api-key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == anthropicStatusOverloaded {
+		return "", &transientError{status: resp.StatusCode, body: string(bodyBytes)}
+	}
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var parsed anthropicResponse
+	if err := json.Unmarshal(bodyBytes, &parsed); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+
+	var answer strings.Builder
+	for _, block := range parsed.Content {
+		if block.Type == "text" {
+			answer.WriteString(block.Text)
+		}
+	}
+	if answer.Len() == 0 {
+		return "", ErrEmptyResponse
+	}
+	return answer.String(), nil
+}
+
+type anthropicRequest struct {
+	Model       string    `json:"model"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aiadvent/internal/config"
+)
+
+func TestAnthropicChatWithMessages(t *testing.T) {
+	var got anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "key" {
+			t.Errorf("missing api key header")
+		}
+		if r.Header.Get("anthropic-version") == "" {
+			t.Errorf("missing anthropic-version header")
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"hello "},{"type":"text","text":"world"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(config.AnthropicConfig{
+		APIKey:       "key",
+		BaseURL:      server.URL,
+		DefaultModel: "claude-test",
+	}, server.Client(), nil)
+
+	answer, err := client.ChatWithMessages(context.Background(), "", []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, Content: "hello"},
+		{Role: RoleUser, Content: "again"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer != "hello world" {
+		t.Fatalf("unexpected answer: %q", answer)
+	}
+	if got.System != "be brief" {
+		t.Fatalf("expected system prompt in dedicated field, got %q", got.System)
+	}
+	if len(got.Messages) != 3 || got.Messages[0].Role != RoleUser || got.Messages[2].Content != "again" {
+		t.Fatalf("unexpected messages: %+v", got.Messages)
+	}
+	if got.MaxTokens != anthropicDefaultMaxTokens {
+		t.Fatalf("expected default max_tokens, got %d", got.MaxTokens)
+	}
+}
+
+func TestAnthropicChatWithMessagesSendsParams(t *testing.T) {
+	var raw map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw = nil
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"ok"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(config.AnthropicConfig{BaseURL: server.URL, DefaultModel: "claude-test"}, server.Client(), nil)
+	messages := []Message{{Role: RoleUser, Content: "q"}}
+
+	if _, err := client.ChatWithMessages(context.Background(), "", messages,
+		WithTemperature(0.2), WithMaxTokens(256), WithTopP(0.9), WithProvider(ProviderPreferences{Order: []string{"x"}})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if raw["temperature"] != 0.2 || raw["max_tokens"] != float64(256) || raw["top_p"] != 0.9 {
+		t.Fatalf("unexpected params in body: %v", raw)
+	}
+	if _, ok := raw["provider"]; ok {
+		t.Fatalf("provider preferences must not be sent to Anthropic: %v", raw)
+	}
+
+	if _, err := client.ChatWithMessages(context.Background(), "", messages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := raw["temperature"]; ok || raw["max_tokens"] != float64(anthropicDefaultMaxTokens) {
+		t.Fatalf("expected provider defaults without params, got %v", raw)
+	}
+}
+
+func TestAnthropicRetriesOverloaded(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(anthropicStatusOverloaded)
+			return
+		}
+		_, _ = w.Write([]byte(`{"content":[{"type":"text","text":"ok"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(config.AnthropicConfig{BaseURL: server.URL, DefaultModel: "claude-test", RetryCount: 2}, server.Client(), nil)
+
+	answer, err := client.ChatCompletion(context.Background(), "hi", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer != "ok" || calls != 2 {
+		t.Fatalf("expected retry then success, got answer=%q calls=%d", answer, calls)
+	}
+}
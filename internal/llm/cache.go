@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// CachedClient оборачивает Client in-memory LRU-кэшем ответов.
+// Ключ — хеш модели, всех сообщений запроса (включая системный промпт) и параметров
+// генерации, поэтому одинаковые вопросы в разных контекстах диалога или с разной
+// temperature не смешиваются.
+// Кэшируются только успешные ответы.
+type CachedClient struct {
+	client Client
+	size   int
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List // в начале — последние использованные
+}
+
+type cacheEntry struct {
+	key       string
+	answer    string
+	expiresAt time.Time
+}
+
+// NewCachedClient создает кэш на size записей. ttl <= 0 — записи не устаревают,
+// вытесняются только по размеру.
+func NewCachedClient(client Client, size int, ttl time.Duration) *CachedClient {
+	return &CachedClient{
+		client: client,
+		size:   size,
+		ttl:    ttl,
+		now:    time.Now,
+		items:  make(map[string]*list.Element),
+		order:  list.New(),
+	}
+}
+
+func (c *CachedClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	key := cacheKey(model, []Message{{Role: RoleUser, Content: prompt}}, ChatParams{})
+	if answer, ok := c.get(key); ok {
+		return answer, nil
+	}
+	answer, err := c.client.ChatCompletion(ctx, prompt, model)
+	if err != nil {
+		return "", err
+	}
+	c.put(key, answer)
+	return answer, nil
+}
+
+func (c *CachedClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	key := cacheKey(model, messages, applyChatOptions(opts))
+	if answer, ok := c.get(key); ok {
+		return answer, nil
+	}
+	answer, err := c.client.ChatWithMessages(ctx, model, messages, opts...)
+	if err != nil {
+		return "", err
+	}
+	c.put(key, answer)
+	return answer, nil
+}
+
+func (c *CachedClient) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expiresAt.IsZero() && c.now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return entry.answer, true
+}
+
+func (c *CachedClient) put(key, answer string) {
+	if c.size <= 0 {
+		return
+	}
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = c.now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.answer, entry.expiresAt = answer, expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, answer: answer, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheKey однозначно кодирует модель, сообщения и параметры: длины полей исключают
+// коллизии вида ("ab", "c") и ("a", "bc").
+func cacheKey(model string, messages []Message, params ChatParams) string {
+	h := sha256.New()
+	writeField := func(s string) {
+		var n [8]byte
+		binary.LittleEndian.PutUint64(n[:], uint64(len(s)))
+		h.Write(n[:])
+		h.Write([]byte(s))
+	}
+	writeField(model)
+	for _, msg := range messages {
+		writeField(msg.Role)
+		writeField(msg.Content)
+	}
+	// Незаданные параметры кодируются как null, поэтому нулевые ChatParams
+	// не совпадают с явно заданными нулями.
+	encoded, _ := json.Marshal(params)
+	writeField(string(encoded))
+	return hex.EncodeToString(h.Sum(nil))
+}
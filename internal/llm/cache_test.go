@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedClientHitAndMiss(t *testing.T) {
+	inner := &recordingClient{}
+	client := NewCachedClient(inner, 10, time.Minute)
+	ctx := context.Background()
+
+	first, _ := client.ChatCompletion(ctx, "вопрос", "model-a")
+	second, _ := client.ChatCompletion(ctx, "вопрос", "model-a")
+	if first != second || len(inner.calls) != 1 {
+		t.Fatalf("expected cache hit, got %q/%q with %d upstream calls", first, second, len(inner.calls))
+	}
+
+	// Другая модель или другой системный промпт — другой ключ.
+	client.ChatCompletion(ctx, "вопрос", "model-b")
+	client.ChatWithMessages(ctx, "model-a", []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "вопрос"},
+	})
+	if len(inner.calls) != 3 {
+		t.Fatalf("expected misses for different model and system prompt, got %d upstream calls", len(inner.calls))
+	}
+}
+
+func TestCachedClientKeyIncludesParams(t *testing.T) {
+	inner := &recordingClient{}
+	client := NewCachedClient(inner, 10, time.Minute)
+	ctx := context.Background()
+	messages := []Message{{Role: RoleUser, Content: "вопрос"}}
+
+	client.ChatWithMessages(ctx, "m", messages)
+	client.ChatWithMessages(ctx, "m", messages, WithTemperature(0))
+	client.ChatWithMessages(ctx, "m", messages, WithTemperature(0.7))
+	if len(inner.calls) != 3 {
+		t.Fatalf("expected misses for different params, got %d upstream calls", len(inner.calls))
+	}
+
+	client.ChatWithMessages(ctx, "m", messages, WithTemperature(0.7))
+	if len(inner.calls) != 3 {
+		t.Fatalf("expected hit for the same params, got %d upstream calls", len(inner.calls))
+	}
+}
+
+func TestCachedClientExpiry(t *testing.T) {
+	inner := &recordingClient{}
+	client := NewCachedClient(inner, 10, time.Minute)
+	now := time.Unix(0, 0)
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	client.ChatCompletion(ctx, "вопрос", "")
+	now = now.Add(30 * time.Second)
+	client.ChatCompletion(ctx, "вопрос", "")
+	if len(inner.calls) != 1 {
+		t.Fatalf("expected hit before ttl, got %d upstream calls", len(inner.calls))
+	}
+
+	now = now.Add(time.Minute)
+	client.ChatCompletion(ctx, "вопрос", "")
+	if len(inner.calls) != 2 {
+		t.Fatalf("expected miss after ttl, got %d upstream calls", len(inner.calls))
+	}
+}
+
+func TestCachedClientEvictsLeastRecentlyUsed(t *testing.T) {
+	inner := &recordingClient{}
+	client := NewCachedClient(inner, 2, 0)
+	ctx := context.Background()
+
+	client.ChatCompletion(ctx, "a", "")
+	client.ChatCompletion(ctx, "b", "")
+	client.ChatCompletion(ctx, "a", "") // a становится самым свежим
+	client.ChatCompletion(ctx, "c", "") // вытесняет b
+
+	client.ChatCompletion(ctx, "a", "")
+	if len(inner.calls) != 3 {
+		t.Fatalf("expected a to stay cached, got %d upstream calls", len(inner.calls))
+	}
+	client.ChatCompletion(ctx, "b", "")
+	if len(inner.calls) != 4 {
+		t.Fatalf("expected b to be evicted, got %d upstream calls", len(inner.calls))
+	}
+}
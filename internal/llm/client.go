@@ -1,8 +1,30 @@
 package llm
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrEmptyResponse модель ответила успешно, но без текста. Часто это срабатывание
+// фильтра контента или неудачный промпт, поэтому пользователю стоит переформулировать вопрос.
+var ErrEmptyResponse = errors.New("empty response from model")
+
+// Message одно сообщение диалога в формате role/content.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
 
 // Client минимальный публичный интерфейс LLM клиента.
 type Client interface {
 	ChatCompletion(ctx context.Context, prompt string, model string) (string, error)
+	// ChatWithMessages отправляет всю историю диалога с сохранением ролей;
+	// opts задают параметры генерации (temperature, max_tokens, top_p).
+	ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error)
 }
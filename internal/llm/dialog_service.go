@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"aiadvent/internal/requestid"
+)
+
+const (
+	defaultSummarizeKeepRecent = 10
+	summaryPrefix              = "Краткое содержание предыдущей части диалога: "
+	maxTitleRunes              = 60
+)
+
+// Summarizer сворачивает старые реплики диалога в короткое резюме.
+type Summarizer func(ctx context.Context, messages []Message) (string, error)
+
+// NewClientSummarizer возвращает Summarizer, который просит ту же модель пересказать реплики.
+func NewClientSummarizer(client Client, model string) Summarizer {
+	return func(ctx context.Context, messages []Message) (string, error) {
+		var transcript strings.Builder
+		for _, msg := range messages {
+			fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+		}
+		return client.ChatWithMessages(ctx, model, []Message{
+			{Role: RoleSystem, Content: "Кратко перескажи диалог, сохранив факты, решения и открытые вопросы. Отвечай только пересказом."},
+			{Role: RoleUser, Content: transcript.String()},
+		})
+	}
+}
+
+// DialogServiceConfig настройки DialogService.
+type DialogServiceConfig struct {
+	// MaxHistoryMessages ограничивает число сообщений истории, отправляемых модели
+	// (без учета системного промпта и текущей реплики). 0 — без ограничения.
+	MaxHistoryMessages int
+	// Summarizer включает сворачивание старых реплик, когда история длиннее SummarizeThreshold.
+	Summarizer         Summarizer
+	SummarizeThreshold int
+	// SummarizeKeepRecent сколько последних сообщений оставлять без сворачивания.
+	SummarizeKeepRecent int
+	Logger              *slog.Logger
+}
+
+// DialogService ведет многоходовые диалоги поверх Client, храня историю в DialogStore.
+type DialogService struct {
+	client             Client
+	store              DialogStore
+	maxHistory         int
+	summarizer         Summarizer
+	summarizeThreshold int
+	summarizeKeep      int
+	logger             *slog.Logger
+}
+
+func NewDialogService(client Client, store DialogStore, cfg DialogServiceConfig) *DialogService {
+	keep := cfg.SummarizeKeepRecent
+	if keep <= 0 {
+		keep = defaultSummarizeKeepRecent
+	}
+	return &DialogService{
+		client:             client,
+		store:              store,
+		maxHistory:         cfg.MaxHistoryMessages,
+		summarizer:         cfg.Summarizer,
+		summarizeThreshold: cfg.SummarizeThreshold,
+		summarizeKeep:      keep,
+		logger:             cfg.Logger,
+	}
+}
+
+// Start регистрирует новый диалог владельца. Пустой title будет заполнен первым вопросом.
+func (s *DialogService) Start(ctx context.Context, dialogID string, ownerID int64, title string) error {
+	return s.store.SetMeta(ctx, dialogID, ownerID, title)
+}
+
+// List возвращает диалоги пользователя, начиная с последних активных.
+func (s *DialogService) List(ctx context.Context, ownerID int64) ([]DialogMeta, error) {
+	return s.store.List(ctx, ownerID)
+}
+
+// Count возвращает число активных диалогов всех пользователей.
+func (s *DialogService) Count(ctx context.Context) (int, error) {
+	return s.store.Count(ctx)
+}
+
+// Chat отправляет модели реплику пользователя вместе с историей диалога
+// и сохраняет обе реплики в историю только после успешного ответа.
+// Пустой systemPrompt не добавляется в запрос.
+func (s *DialogService) Chat(ctx context.Context, dialogID, systemPrompt, userText, model string) (string, error) {
+	answer, _, err := s.ChatWithMeta(ctx, dialogID, systemPrompt, userText, model)
+	return answer, err
+}
+
+// ChatWithMeta как Chat, но дополнительно возвращает расход на ответ. Токены и стоимость
+// включают суммаризацию истории; их сообщает клиент провайдера, поддерживающий учет
+// (сейчас OpenRouter), а ответы из кэша ничего не стоят. Duration — полное время Chat.
+func (s *DialogService) ChatWithMeta(ctx context.Context, dialogID, systemPrompt, userText, model string) (string, Meta, error) {
+	start := time.Now()
+	ctx, rec := withMetaRecorder(ctx)
+	answer, err := s.chat(ctx, dialogID, systemPrompt, userText, model)
+	if err != nil {
+		return "", Meta{}, err
+	}
+
+	meta := rec.Meta()
+	meta.Duration = time.Since(start)
+	if meta.Model == "" {
+		meta.Model = model
+	}
+	return answer, meta, nil
+}
+
+func (s *DialogService) chat(ctx context.Context, dialogID, systemPrompt, userText, model string) (string, error) {
+	history, err := s.store.Get(ctx, dialogID)
+	if err != nil {
+		return "", fmt.Errorf("load dialog: %w", err)
+	}
+	history = s.maybeSummarize(ctx, dialogID, history)
+
+	userMsg := Message{Role: RoleUser, Content: userText}
+	messages := make([]Message, 0, len(history)+2)
+	if systemPrompt != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: systemPrompt})
+	}
+	messages = append(messages, s.trimHistory(history)...)
+	messages = append(messages, userMsg)
+
+	answer, err := s.client.ChatWithMessages(ctx, model, messages)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.store.Append(ctx, dialogID, userMsg, Message{Role: RoleAssistant, Content: answer}); err != nil {
+		return "", fmt.Errorf("save dialog: %w", err)
+	}
+	s.ensureTitle(ctx, dialogID, userText)
+	return answer, nil
+}
+
+// ensureTitle называет диалог по первому вопросу, если заголовок не задан явно.
+func (s *DialogService) ensureTitle(ctx context.Context, dialogID, userText string) {
+	meta, ok, err := s.store.GetMeta(ctx, dialogID)
+	if err != nil || !ok || meta.Title != "" {
+		return
+	}
+	title := []rune(strings.TrimSpace(userText))
+	if len(title) > maxTitleRunes {
+		title = append(title[:maxTitleRunes], '…')
+	}
+	if err := s.store.SetMeta(ctx, dialogID, meta.OwnerID, string(title)); err != nil && s.logger != nil {
+		s.logger.Warn("dialog set title failed",
+			requestid.Attr(ctx),
+			slog.String("dialog_id", dialogID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// maybeSummarize заменяет старые реплики одним резюме и сохраняет сжатую историю.
+// При ошибке суммаризации возвращает историю без изменений — ее ограничит trimHistory.
+func (s *DialogService) maybeSummarize(ctx context.Context, dialogID string, history []Message) []Message {
+	if s.summarizer == nil || s.summarizeThreshold <= 0 || len(history) <= s.summarizeThreshold {
+		return history
+	}
+
+	split := len(history) - s.summarizeKeep
+	if split <= 0 {
+		return history
+	}
+	// Свежая часть должна начинаться с реплики пользователя.
+	for split < len(history) && history[split].Role != RoleUser {
+		split++
+	}
+
+	summary, err := s.summarizer(ctx, history[:split])
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Warn("dialog summarize failed",
+				requestid.Attr(ctx),
+				slog.String("dialog_id", dialogID),
+				slog.String("error", err.Error()))
+		}
+		return history
+	}
+
+	compacted := make([]Message, 0, len(history)-split+1)
+	compacted = append(compacted, Message{Role: RoleSystem, Content: summaryPrefix + summary})
+	compacted = append(compacted, history[split:]...)
+
+	if err := s.store.Set(ctx, dialogID, compacted); err != nil && s.logger != nil {
+		s.logger.Warn("dialog save summary failed",
+			requestid.Attr(ctx),
+			slog.String("dialog_id", dialogID),
+			slog.String("error", err.Error()))
+	}
+	return compacted
+}
+
+// trimHistory оставляет только последние maxHistory сообщений истории.
+// Окно всегда начинается с реплики пользователя, чтобы не нарушать чередование ролей;
+// резюме в начале истории сохраняется и в лимит не входит.
+func (s *DialogService) trimHistory(history []Message) []Message {
+	var summary []Message
+	if len(history) > 0 && history[0].Role == RoleSystem {
+		summary, history = []Message{history[0]}, history[1:]
+	}
+	if s.maxHistory <= 0 || len(history) <= s.maxHistory {
+		return append(summary, history...)
+	}
+	trimmed := history[len(history)-s.maxHistory:]
+	for len(trimmed) > 0 && trimmed[0].Role != RoleUser {
+		trimmed = trimmed[1:]
+	}
+	return append(summary, trimmed...)
+}
+
+// Reset удаляет историю диалога.
+func (s *DialogService) Reset(ctx context.Context, dialogID string) error {
+	return s.store.Delete(ctx, dialogID)
+}
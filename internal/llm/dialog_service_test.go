@@ -0,0 +1,353 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"aiadvent/internal/config"
+)
+
+type recordingClient struct {
+	mu    sync.Mutex
+	calls [][]Message
+}
+
+func (c *recordingClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return c.ChatWithMessages(ctx, model, []Message{{Role: RoleUser, Content: prompt}})
+}
+
+func (c *recordingClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = append(c.calls, append([]Message(nil), messages...))
+	return fmt.Sprintf("answer %d", len(c.calls)), nil
+}
+
+func TestDialogServiceChatIncludesHistory(t *testing.T) {
+	client := &recordingClient{}
+	service := NewDialogService(client, NewMemoryDialogStore(time.Hour, 0), DialogServiceConfig{})
+	ctx := context.Background()
+
+	if _, err := service.Chat(ctx, "7:1", "", "first", ""); err != nil {
+		t.Fatalf("first chat: %v", err)
+	}
+	if _, err := service.Chat(ctx, "7:1", "be brief", "second", ""); err != nil {
+		t.Fatalf("second chat: %v", err)
+	}
+
+	last := client.calls[1]
+	want := []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "first"},
+		{Role: RoleAssistant, Content: "answer 1"},
+		{Role: RoleUser, Content: "second"},
+	}
+	if len(last) != len(want) {
+		t.Fatalf("expected %d messages, got %d: %+v", len(want), len(last), last)
+	}
+	for i := range want {
+		if last[i] != want[i] {
+			t.Fatalf("message %d mismatch: got %+v want %+v", i, last[i], want[i])
+		}
+	}
+
+	if err := service.Reset(ctx, "7:1"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if _, err := service.Chat(ctx, "7:1", "", "third", ""); err != nil {
+		t.Fatalf("third chat: %v", err)
+	}
+	if got := len(client.calls[2]); got != 1 {
+		t.Fatalf("expected fresh dialog after reset, got %d messages", got)
+	}
+}
+
+func TestDialogServiceCapsHistory(t *testing.T) {
+	client := &recordingClient{}
+	service := NewDialogService(client, NewMemoryDialogStore(time.Hour, 0), DialogServiceConfig{MaxHistoryMessages: 4})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if _, err := service.Chat(ctx, "7:1", "system", fmt.Sprintf("question %d", i), ""); err != nil {
+			t.Fatalf("chat %d: %v", i, err)
+		}
+	}
+
+	last := client.calls[len(client.calls)-1]
+	// системный промпт + 4 сообщения истории + текущий вопрос
+	if len(last) != 6 {
+		t.Fatalf("expected capped history of 6 messages, got %d: %+v", len(last), last)
+	}
+	if last[0].Role != RoleSystem {
+		t.Fatalf("system prompt must be kept, got %+v", last[0])
+	}
+	if last[1].Role != RoleUser || last[1].Content != "question 7" {
+		t.Fatalf("expected window to start with the oldest kept user turn, got %+v", last[1])
+	}
+	if last[5].Content != "question 9" {
+		t.Fatalf("expected current question last, got %+v", last[5])
+	}
+}
+
+func TestDialogServiceTrimKeepsUserFirst(t *testing.T) {
+	service := NewDialogService(&recordingClient{}, NewMemoryDialogStore(0, 0), DialogServiceConfig{MaxHistoryMessages: 3})
+	history := []Message{
+		{Role: RoleUser, Content: "q1"},
+		{Role: RoleAssistant, Content: "a1"},
+		{Role: RoleUser, Content: "q2"},
+		{Role: RoleAssistant, Content: "a2"},
+	}
+
+	trimmed := service.trimHistory(history)
+	if len(trimmed) != 2 || trimmed[0].Content != "q2" {
+		t.Fatalf("expected window to drop dangling assistant turn, got %+v", trimmed)
+	}
+}
+
+func TestDialogServiceSummarizesOldTurns(t *testing.T) {
+	client := &recordingClient{}
+	store := NewMemoryDialogStore(time.Hour, 0)
+	var summarized []Message
+	service := NewDialogService(client, store, DialogServiceConfig{
+		SummarizeThreshold:  4,
+		SummarizeKeepRecent: 2,
+		Summarizer: func(ctx context.Context, messages []Message) (string, error) {
+			summarized = append([]Message(nil), messages...)
+			return "summary", nil
+		},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.Chat(ctx, "7:1", "", fmt.Sprintf("question %d", i), ""); err != nil {
+			t.Fatalf("chat %d: %v", i, err)
+		}
+	}
+
+	// Перед третьим вопросом в истории 4 сообщения — порог еще не превышен.
+	if summarized != nil {
+		t.Fatalf("summarizer must not run below threshold")
+	}
+	if _, err := service.Chat(ctx, "7:1", "", "question 3", ""); err != nil {
+		t.Fatalf("chat 3: %v", err)
+	}
+
+	if len(summarized) != 4 || summarized[0].Content != "question 0" {
+		t.Fatalf("expected the oldest 4 messages to be summarized, got %+v", summarized)
+	}
+
+	history, err := store.Get(ctx, "7:1")
+	if err != nil {
+		t.Fatalf("get history: %v", err)
+	}
+	if history[0].Role != RoleSystem || history[0].Content != summaryPrefix+"summary" {
+		t.Fatalf("expected summary note first, got %+v", history[0])
+	}
+	if history[1].Content != "question 2" {
+		t.Fatalf("expected recent turns to be kept, got %+v", history[1])
+	}
+	if len(history) != 5 {
+		t.Fatalf("expected summary + 2 recent + new turn, got %d: %+v", len(history), history)
+	}
+
+	last := client.calls[len(client.calls)-1]
+	if last[0].Content != summaryPrefix+"summary" || last[len(last)-1].Content != "question 3" {
+		t.Fatalf("expected compacted history in request, got %+v", last)
+	}
+}
+
+func TestDialogMetaAndList(t *testing.T) {
+	store := NewMemoryDialogStore(time.Hour, 0)
+	service := NewDialogService(&recordingClient{}, store, DialogServiceConfig{})
+	ctx := context.Background()
+
+	if err := service.Start(ctx, "7:1", 7, ""); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := service.Chat(ctx, "7:1", "", "How to plan a trip?", ""); err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := service.Start(ctx, "7:2", 7, "Second"); err != nil {
+		t.Fatalf("start second: %v", err)
+	}
+	if err := service.Start(ctx, "8:1", 8, "Foreign"); err != nil {
+		t.Fatalf("start foreign: %v", err)
+	}
+
+	dialogs, err := service.List(ctx, 7)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(dialogs) != 2 {
+		t.Fatalf("expected 2 dialogs for owner 7, got %+v", dialogs)
+	}
+	if dialogs[0].ID != "7:2" || dialogs[0].Title != "Second" {
+		t.Fatalf("expected most recent dialog first, got %+v", dialogs[0])
+	}
+	first := dialogs[1]
+	if first.Title != "How to plan a trip?" {
+		t.Fatalf("expected title from the first question, got %q", first.Title)
+	}
+	if first.MessageCount != 2 || first.CreatedAt.IsZero() || first.LastTouched.Before(first.CreatedAt) {
+		t.Fatalf("unexpected meta: %+v", first)
+	}
+}
+
+func TestMemoryDialogStoreExpires(t *testing.T) {
+	store := NewMemoryDialogStore(time.Millisecond, 0)
+	ctx := context.Background()
+
+	if err := store.Append(ctx, "1:1", Message{Role: RoleUser, Content: "hi"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	history, err := store.Get(ctx, "1:1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("expected expired dialog to be empty, got %+v", history)
+	}
+}
+
+func TestMemoryDialogStoreCount(t *testing.T) {
+	store := NewMemoryDialogStore(time.Hour, 0)
+	ctx := context.Background()
+
+	count, err := store.Count(ctx)
+	if err != nil || count != 0 {
+		t.Fatalf("expected empty store, got %d, %v", count, err)
+	}
+	for _, id := range []string{"1:1", "1:2", "2:1"} {
+		if err := store.Append(ctx, id, Message{Role: RoleUser, Content: "hi"}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if err := store.Delete(ctx, "1:2"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	count, err = store.Count(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 dialogs, got %d", count)
+	}
+}
+
+func TestMemoryDialogStoreCountSkipsExpired(t *testing.T) {
+	store := NewMemoryDialogStore(20*time.Millisecond, 0)
+	ctx := context.Background()
+
+	if err := store.Append(ctx, "1:1", Message{Role: RoleUser, Content: "old"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if err := store.Append(ctx, "2:1", Message{Role: RoleUser, Content: "fresh"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	count, err := store.Count(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected expired dialog to be excluded, got %d", count)
+	}
+}
+
+func TestMemoryDialogStoreDeletesExpired(t *testing.T) {
+	store := NewMemoryDialogStore(20*time.Millisecond, 0)
+	ctx := context.Background()
+
+	if err := store.Append(ctx, "1:1", Message{Role: RoleUser, Content: "old"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if err := store.Append(ctx, "2:1", Message{Role: RoleUser, Content: "fresh"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if _, ok := store.dialogs["1:1"]; ok || len(store.dialogs) != 1 {
+		t.Fatalf("expected expired dialog to be removed from memory, got %d dialogs", len(store.dialogs))
+	}
+}
+
+func TestMemoryDialogStoreEvictsLeastRecentlyTouched(t *testing.T) {
+	store := NewMemoryDialogStore(time.Hour, 2)
+	ctx := context.Background()
+
+	for _, id := range []string{"1:1", "2:1"} {
+		if err := store.Append(ctx, id, Message{Role: RoleUser, Content: id}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Обращение к первому диалогу делает самым старым второй.
+	if err := store.Append(ctx, "1:1", Message{Role: RoleAssistant, Content: "answer"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := store.Set(ctx, "3:1", []Message{{Role: RoleUser, Content: "new"}}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	count, err := store.Count(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected cap of 2 dialogs, got %d", count)
+	}
+	if history, _ := store.Get(ctx, "2:1"); len(history) != 0 {
+		t.Fatalf("expected least recently touched dialog to be evicted, got %+v", history)
+	}
+	if history, _ := store.Get(ctx, "1:1"); len(history) != 2 {
+		t.Fatalf("expected recently touched dialog to survive, got %+v", history)
+	}
+}
+
+func TestDialogChatWithMetaFromOpenRouter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"model":"openai/gpt-4o-mini-2024-07-18","choices":[{"message":{"role":"assistant","content":"answer"}}],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15,"cost":0.0021}}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenRouterClient(config.OpenRouterConfig{BaseURL: server.URL, DefaultModel: "openai/gpt-4o-mini"}, server.Client(), nil)
+	// Расход должен доходить и через декораторы клиента.
+	service := NewDialogService(NewSingleflightClient(client), NewMemoryDialogStore(time.Hour, 0), DialogServiceConfig{})
+
+	answer, meta, err := service.ChatWithMeta(context.Background(), "1:1", "", "question", "")
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if answer != "answer" {
+		t.Fatalf("unexpected answer: %q", answer)
+	}
+	if meta.Tokens != 15 || meta.Cost != 0.0021 || meta.Model != "openai/gpt-4o-mini-2024-07-18" {
+		t.Fatalf("unexpected meta: %+v", meta)
+	}
+	if meta.Duration <= 0 {
+		t.Fatalf("expected duration to be measured, got %v", meta.Duration)
+	}
+
+	plain := NewDialogService(&recordingClient{}, NewMemoryDialogStore(time.Hour, 0), DialogServiceConfig{})
+	_, meta, err = plain.ChatWithMeta(context.Background(), "1:1", "", "question", "some-model")
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if meta.Tokens != 0 || meta.Model != "some-model" {
+		t.Fatalf("expected only requested model for client without usage, got %+v", meta)
+	}
+}
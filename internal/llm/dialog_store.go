@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DialogStore хранит историю сообщений диалогов по dialogID.
+type DialogStore interface {
+	Get(ctx context.Context, dialogID string) ([]Message, error)
+	Append(ctx context.Context, dialogID string, messages ...Message) error
+	Set(ctx context.Context, dialogID string, messages []Message) error
+	Delete(ctx context.Context, dialogID string) error
+	// SetMeta задает владельца и заголовок диалога, создавая его при необходимости.
+	SetMeta(ctx context.Context, dialogID string, ownerID int64, title string) error
+	// GetMeta возвращает метаданные живого диалога.
+	GetMeta(ctx context.Context, dialogID string) (DialogMeta, bool, error)
+	// List возвращает диалоги владельца, начиная с последних активных.
+	List(ctx context.Context, ownerID int64) ([]DialogMeta, error)
+	// Count возвращает число неистекших диалогов.
+	Count(ctx context.Context) (int, error)
+}
+
+// DialogMeta сводка о диалоге без самих сообщений.
+type DialogMeta struct {
+	ID           string
+	OwnerID      int64
+	Title        string
+	CreatedAt    time.Time
+	LastTouched  time.Time
+	MessageCount int
+}
+
+type dialog struct {
+	messages    []Message
+	ownerID     int64
+	title       string
+	createdAt   time.Time
+	lastTouched time.Time
+}
+
+// MemoryDialogStore потокобезопасное in-memory хранилище диалогов.
+// Диалог, не обновлявшийся дольше ttl, считается истекшим; ttl <= 0 отключает истечение.
+// При maxDialogs > 0 создание диалога сверх лимита вытесняет самый давно не обновлявшийся.
+// Истекшие диалоги удаляются при записи, не чаще раза в ttl.
+type MemoryDialogStore struct {
+	mu         sync.RWMutex
+	ttl        time.Duration
+	maxDialogs int
+	dialogs    map[string]*dialog
+	lastSweep  time.Time
+}
+
+func NewMemoryDialogStore(ttl time.Duration, maxDialogs int) *MemoryDialogStore {
+	return &MemoryDialogStore{
+		ttl:        ttl,
+		maxDialogs: maxDialogs,
+		dialogs:    make(map[string]*dialog),
+	}
+}
+
+// Get возвращает копию истории диалога; для неизвестного или истекшего диалога — пустую историю.
+func (s *MemoryDialogStore) Get(ctx context.Context, dialogID string) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.dialogs[dialogID]
+	if !ok || s.expired(d, time.Now()) {
+		return nil, nil
+	}
+	result := make([]Message, len(d.messages))
+	copy(result, d.messages)
+	return result, nil
+}
+
+func (s *MemoryDialogStore) Append(ctx context.Context, dialogID string, messages ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.touchLocked(dialogID)
+	d.messages = append(d.messages, messages...)
+	return nil
+}
+
+func (s *MemoryDialogStore) Set(ctx context.Context, dialogID string, messages []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.touchLocked(dialogID)
+	d.messages = append([]Message(nil), messages...)
+	return nil
+}
+
+func (s *MemoryDialogStore) Delete(ctx context.Context, dialogID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.dialogs, dialogID)
+	return nil
+}
+
+func (s *MemoryDialogStore) SetMeta(ctx context.Context, dialogID string, ownerID int64, title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.touchLocked(dialogID)
+	d.ownerID = ownerID
+	d.title = title
+	return nil
+}
+
+func (s *MemoryDialogStore) GetMeta(ctx context.Context, dialogID string) (DialogMeta, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.dialogs[dialogID]
+	if !ok || s.expired(d, time.Now()) {
+		return DialogMeta{}, false, nil
+	}
+	return d.meta(dialogID), true, nil
+}
+
+func (s *MemoryDialogStore) List(ctx context.Context, ownerID int64) ([]DialogMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var result []DialogMeta
+	for id, d := range s.dialogs {
+		if d.ownerID != ownerID || s.expired(d, now) {
+			continue
+		}
+		result = append(result, d.meta(id))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastTouched.After(result[j].LastTouched)
+	})
+	return result, nil
+}
+
+func (s *MemoryDialogStore) Count(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	count := 0
+	for _, d := range s.dialogs {
+		if !s.expired(d, now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// touchLocked возвращает живой диалог, создавая новый вместо отсутствующего или истекшего.
+func (s *MemoryDialogStore) touchLocked(dialogID string) *dialog {
+	now := time.Now()
+	s.sweepExpiredLocked(now)
+	d, ok := s.dialogs[dialogID]
+	if !ok || s.expired(d, now) {
+		if !ok && s.maxDialogs > 0 && len(s.dialogs) >= s.maxDialogs {
+			s.evictOldestLocked()
+		}
+		d = &dialog{createdAt: now}
+		s.dialogs[dialogID] = d
+	}
+	d.lastTouched = now
+	return d
+}
+
+// sweepExpiredLocked удаляет истекшие диалоги, иначе без лимита maxDialogs они
+// оставались бы в памяти навсегда. Полный проход делается не чаще раза в ttl.
+func (s *MemoryDialogStore) sweepExpiredLocked(now time.Time) {
+	if s.ttl <= 0 || now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	for id, d := range s.dialogs {
+		if s.expired(d, now) {
+			delete(s.dialogs, id)
+		}
+	}
+	s.lastSweep = now
+}
+
+// evictOldestLocked удаляет диалог с самым старым lastTouched. Истекшие диалоги
+// старше любых живых, поэтому уходят первыми.
+func (s *MemoryDialogStore) evictOldestLocked() {
+	var (
+		oldestID string
+		oldest   time.Time
+	)
+	for id, d := range s.dialogs {
+		if oldestID == "" || d.lastTouched.Before(oldest) {
+			oldestID, oldest = id, d.lastTouched
+		}
+	}
+	delete(s.dialogs, oldestID)
+}
+
+func (d *dialog) meta(id string) DialogMeta {
+	return DialogMeta{
+		ID:           id,
+		OwnerID:      d.ownerID,
+		Title:        d.title,
+		CreatedAt:    d.createdAt,
+		LastTouched:  d.lastTouched,
+		MessageCount: len(d.messages),
+	}
+}
+
+func (s *MemoryDialogStore) expired(d *dialog, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(d.lastTouched) > s.ttl
+}
@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"aiadvent/internal/requestid"
+)
+
+// FallbackClient при ошибке основной модели по очереди пробует резервные.
+// Сначала всегда используется модель, выбранная вызывающим (или модель по умолчанию).
+// Ответ резервной модели возвращается как есть, а сама модель попадает в Meta
+// (Model и Fallback), чтобы вызывающий мог показать пользователю, кто ответил.
+type FallbackClient struct {
+	client       Client
+	defaultModel string
+	models       []string
+	logger       *slog.Logger
+}
+
+// NewFallbackClient оборачивает client резервными models. defaultModel — модель,
+// которую client использует при пустой модели: резервная модель, совпадающая с ней,
+// не повторяет уже неудавшийся запрос.
+func NewFallbackClient(client Client, defaultModel string, models []string, logger *slog.Logger) *FallbackClient {
+	return &FallbackClient{client: client, defaultModel: defaultModel, models: models, logger: logger}
+}
+
+func (c *FallbackClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return c.ChatWithMessages(ctx, model, []Message{{Role: RoleUser, Content: prompt}})
+}
+
+func (c *FallbackClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	if model == "" {
+		model = c.defaultModel
+	}
+	answer, err := c.client.ChatWithMessages(ctx, model, messages, opts...)
+	if err == nil {
+		return answer, nil
+	}
+
+	for _, fallback := range c.models {
+		// Отмена запроса пользователем или истекший таймаут — пробовать другие модели бессмысленно.
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			return "", err
+		}
+		if fallback == model {
+			continue
+		}
+		if c.logger != nil {
+			c.logger.Warn("llm fallback",
+				requestid.Attr(ctx),
+				slog.String("failed_model", model),
+				slog.String("fallback_model", fallback),
+				slog.String("error", err.Error()))
+		}
+
+		var fallbackErr error
+		answer, fallbackErr = c.client.ChatWithMessages(ctx, fallback, messages, opts...)
+		if fallbackErr == nil {
+			recordMeta(ctx, Meta{Model: fallback, Fallback: true})
+			return answer, nil
+		}
+		model, err = fallback, fallbackErr
+	}
+	return "", err
+}
@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type modelStubClient struct {
+	failing map[string]bool
+	models  []string
+}
+
+func (c *modelStubClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return c.ChatWithMessages(ctx, model, nil)
+}
+
+func (c *modelStubClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	c.models = append(c.models, model)
+	if c.failing[model] {
+		return "", errors.New(model + " unavailable")
+	}
+	return "answer from " + model, nil
+}
+
+func TestFallbackClientUsesNextModel(t *testing.T) {
+	inner := &modelStubClient{failing: map[string]bool{"primary": true, "backup-1": true}}
+	client := NewFallbackClient(inner, "", []string{"backup-1", "backup-2"}, nil)
+
+	ctx, meta := WithMeta(context.Background())
+	answer, err := client.ChatCompletion(ctx, "q", "primary")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer != "answer from backup-2" {
+		t.Fatalf("expected answer without annotation, got %q", answer)
+	}
+	if m := meta(); !m.Fallback || m.Model != "backup-2" {
+		t.Fatalf("expected fallback model in meta, got %+v", m)
+	}
+	if len(inner.models) != 3 || inner.models[0] != "primary" {
+		t.Fatalf("expected primary model to be tried first, got %v", inner.models)
+	}
+}
+
+func TestFallbackClientPrimarySuccessIsNotAnnotated(t *testing.T) {
+	inner := &modelStubClient{}
+	client := NewFallbackClient(inner, "", []string{"backup"}, nil)
+
+	ctx, meta := WithMeta(context.Background())
+	answer, _ := client.ChatCompletion(ctx, "q", "primary")
+	if answer != "answer from primary" || len(inner.models) != 1 {
+		t.Fatalf("unexpected answer %q after calls %v", answer, inner.models)
+	}
+	if meta().Fallback {
+		t.Fatal("primary answer must not be reported as fallback")
+	}
+}
+
+func TestFallbackClientReturnsLastError(t *testing.T) {
+	inner := &modelStubClient{failing: map[string]bool{"primary": true, "backup": true}}
+	client := NewFallbackClient(inner, "", []string{"backup"}, nil)
+
+	_, err := client.ChatCompletion(context.Background(), "q", "primary")
+	if err == nil || err.Error() != "backup unavailable" {
+		t.Fatalf("expected last fallback error, got %v", err)
+	}
+}
+
+func TestFallbackClientStopsOnCancelledContext(t *testing.T) {
+	inner := &modelStubClient{failing: map[string]bool{"primary": true}}
+	client := NewFallbackClient(inner, "", []string{"backup"}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.ChatCompletion(ctx, "q", "primary"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(inner.models) != 1 {
+		t.Fatalf("expected no fallback after cancellation, got %v", inner.models)
+	}
+}
+
+func TestFallbackClientSkipsDefaultModel(t *testing.T) {
+	inner := &modelStubClient{failing: map[string]bool{"primary": true}}
+	client := NewFallbackClient(inner, "primary", []string{"primary", "backup"}, nil)
+
+	answer, err := client.ChatCompletion(context.Background(), "q", "")
+	if err != nil || answer != "answer from backup" {
+		t.Fatalf("unexpected answer %q, err %v", answer, err)
+	}
+	if len(inner.models) != 2 || inner.models[0] != "primary" || inner.models[1] != "backup" {
+		t.Fatalf("expected default model to be tried once, got %v", inner.models)
+	}
+}
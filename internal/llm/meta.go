@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Meta сведения о расходе на один ответ: токены, стоимость, фактическая модель и время.
+type Meta struct {
+	Tokens   int
+	Model    string
+	Cost     float64
+	Duration time.Duration
+	// Fallback ответила резервная модель (LLM_FALLBACK_MODELS), ее имя в Model.
+	Fallback bool
+}
+
+type metaKey struct{}
+
+// metaRecorder копит Meta всех запросов к провайдеру в рамках одного ctx, включая
+// вспомогательные (суммаризацию). Передается через контекст, чтобы проходить сквозь
+// декораторы Client; ответы из кэша ничего не добавляют.
+type metaRecorder struct {
+	mu   sync.Mutex
+	meta Meta
+}
+
+func withMetaRecorder(ctx context.Context) (context.Context, *metaRecorder) {
+	rec := &metaRecorder{}
+	return context.WithValue(ctx, metaKey{}, rec), rec
+}
+
+// recordMeta добавляет расход запроса к recorder-у из ctx, если он есть.
+func recordMeta(ctx context.Context, meta Meta) {
+	rec, ok := ctx.Value(metaKey{}).(*metaRecorder)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.meta.Tokens += meta.Tokens
+	rec.meta.Cost += meta.Cost
+	if meta.Model != "" {
+		rec.meta.Model = meta.Model
+	}
+	if meta.Fallback {
+		rec.meta.Fallback = true
+	}
+}
+
+// WithMeta добавляет в ctx сборщик Meta для запросов к Client с этим ctx и возвращает
+// функцию, читающую накопленное. Для диалогов то же делает DialogService.ChatWithMeta.
+func WithMeta(ctx context.Context) (context.Context, func() Meta) {
+	ctx, rec := withMetaRecorder(ctx)
+	return ctx, rec.Meta
+}
+
+func (r *metaRecorder) Meta() Meta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.meta
+}
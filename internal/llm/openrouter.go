@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"aiadvent/internal/config"
+	"aiadvent/internal/requestid"
 	"log/slog"
 )
 
@@ -22,25 +24,52 @@ type OpenRouterClient struct {
 	apiKey       string
 	baseURL      string
 	defaultModel string
-	httpClient   *http.Client
-	retryCount   int
-	backoff      time.Duration
-	logger       *slog.Logger
+	appURL       string
+	appName      string
+	provider     *ProviderPreferences
+	// showReasoning добавляет к ответу рассуждения модели; по умолчанию они отбрасываются.
+	showReasoning bool
+	httpClient    *http.Client
+	retryCount    int
+	backoff       time.Duration
+	logger        *slog.Logger
 }
 
 func NewOpenRouterClient(cfg config.OpenRouterConfig, httpClient *http.Client, logger *slog.Logger) Client {
+	var provider *ProviderPreferences
+	prefs := ProviderPreferences{
+		Order:             cfg.ProviderOrder,
+		AllowFallbacks:    cfg.AllowFallbacks,
+		RequireParameters: cfg.RequireParameters,
+	}
+	if !prefs.isZero() {
+		provider = &prefs
+	}
+
 	return &OpenRouterClient{
-		apiKey:       cfg.APIKey,
-		baseURL:      cfg.BaseURL,
-		defaultModel: cfg.DefaultModel,
-		httpClient:   httpClient,
-		retryCount:   2,
-		backoff:      500 * time.Millisecond,
-		logger:       logger,
+		apiKey:        cfg.APIKey,
+		baseURL:       cfg.BaseURL,
+		defaultModel:  cfg.DefaultModel,
+		appURL:        cfg.AppURL,
+		appName:       cfg.AppName,
+		provider:      provider,
+		showReasoning: cfg.ShowReasoning,
+		httpClient:    httpClient,
+		retryCount:    cfg.RetryCount,
+		backoff:       cfg.RetryBackoff,
+		logger:        logger,
 	}
 }
 
 func (c *OpenRouterClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return c.ChatWithMessages(ctx, model, []Message{
+		{Role: RoleUser, Content: prompt},
+	})
+}
+
+// ChatWithMessages отправляет историю в chat/completions. Маршрутизация из opts
+// (WithProvider) заменяет заданную в конфигурации.
+func (c *OpenRouterClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
 	if model == "" {
 		model = c.defaultModel
 	}
@@ -48,111 +77,170 @@ func (c *OpenRouterClient) ChatCompletion(ctx context.Context, prompt string, mo
 		return "", ErrInvalidModel
 	}
 
+	params := applyChatOptions(opts)
+	if params.Provider == nil {
+		params.Provider = c.provider
+	}
 	requestBody := openRouterRequest{
-		Model: model,
-		Messages: []message{
-			{Role: "user", Content: prompt},
-		},
-	}
-
-	var lastErr error
-	for attempt := 0; attempt <= c.retryCount; attempt++ {
-		answer, err := c.doRequest(ctx, requestBody)
-		if err == nil {
-			return answer, nil
-		}
-		if !shouldRetry(err) || attempt == c.retryCount {
-			return "", err
-		}
-		lastErr = err
-		if c.logger != nil {
-			c.logger.Warn("openrouter retry",
-				slog.Int("attempt", attempt+1),
-				slog.String("error", err.Error()))
-		}
-
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-time.After(c.backoff * time.Duration(attempt+1)):
-		}
-	}
-	return "", fmt.Errorf("openrouter request failed: %w", lastErr)
+		Model:       model,
+		Messages:    messages,
+		Temperature: params.Temperature,
+		MaxTokens:   params.MaxTokens,
+		TopP:        params.TopP,
+		Provider:    params.Provider,
+	}
+
+	start := time.Now()
+	attempts := 0
+	var meta Meta
+	answer, err := withRetries(ctx, c.retryCount, c.backoff, c.logger, "openrouter", func() (string, error) {
+		attempts++
+		answer, m, err := c.doRequest(ctx, requestBody)
+		meta = m
+		return answer, err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	meta.Duration = time.Since(start)
+	if meta.Model == "" {
+		meta.Model = model
+	}
+	recordMeta(ctx, meta)
+	if c.logger != nil {
+		c.logger.Info("openrouter completion",
+			requestid.Attr(ctx),
+			slog.String("model", model),
+			slog.Int64("duration_ms", meta.Duration.Milliseconds()),
+			slog.Int("prompt_len", messagesLen(messages)),
+			slog.Int("completion_len", len(answer)),
+			slog.Int("tokens", meta.Tokens),
+			slog.Int("attempts", attempts))
+	}
+	return answer, nil
+}
+
+// messagesLen суммарная длина содержимого сообщений в байтах.
+func messagesLen(messages []Message) int {
+	n := 0
+	for _, msg := range messages {
+		n += len(msg.Content)
+	}
+	return n
 }
 
-func (c *OpenRouterClient) doRequest(ctx context.Context, body openRouterRequest) (string, error) {
+// doRequest выполняет одну попытку запроса и возвращает ответ с расходом из поля usage.
+func (c *OpenRouterClient) doRequest(ctx context.Context, body openRouterRequest) (string, Meta, error) {
 	buf, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return "", Meta{}, fmt.Errorf("marshal request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/chat/completions", c.baseURL), bytes.NewReader(buf))
 	if err != nil {
-		return "", fmt.Errorf("build request: %w", err)
+		return "", Meta{}, fmt.Errorf("build request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	if c.apiKey != "" {
 		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
+	// Заголовки атрибуции OpenRouter: по ним приложение видно в рейтингах и маршрутизации бесплатных моделей.
+	if c.appURL != "" {
+		req.Header.Set("HTTP-Referer", c.appURL)
+	}
+	if c.appName != "" {
+		req.Header.Set("X-Title", c.appName)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("execute request: %w", err)
+		return "", Meta{}, fmt.Errorf("execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
+		return "", Meta{}, fmt.Errorf("read response: %w", err)
 	}
 
 	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
-		return "", &transientError{status: resp.StatusCode, body: string(bodyBytes)}
+		return "", Meta{}, &transientError{status: resp.StatusCode, body: string(bodyBytes)}
 	}
 
 	if resp.StatusCode >= 300 {
-		return "", fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(bodyBytes))
+		return "", Meta{}, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	var parsed openRouterResponse
 	if err := json.Unmarshal(bodyBytes, &parsed); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
+		return "", Meta{}, fmt.Errorf("decode response: %w", err)
 	}
-	if len(parsed.Choices) == 0 || parsed.Choices[0].Message.Content == "" {
-		return "", errors.New("empty response from model")
+	if len(parsed.Choices) == 0 {
+		return "", Meta{}, ErrEmptyResponse
 	}
-	return parsed.Choices[0].Message.Content, nil
-}
 
-func shouldRetry(err error) bool {
-	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
-		return false
+	message := parsed.Choices[0].Message
+	content, reasoning := message.Content, message.Reasoning
+	if reasoning == "" {
+		reasoning, content = splitThinkBlock(content)
+	}
+	if content == "" {
+		return "", Meta{}, ErrEmptyResponse
+	}
+	meta := Meta{
+		Tokens: parsed.Usage.TotalTokens,
+		Model:  parsed.Model,
+		Cost:   parsed.Usage.Cost,
 	}
-	var te *transientError
-	return errors.As(err, &te)
+	if c.showReasoning && reasoning != "" {
+		return fmt.Sprintf("Рассуждение модели:\n%s\n\nОтвет:\n%s", reasoning, content), meta, nil
+	}
+	return content, meta, nil
 }
 
-type openRouterRequest struct {
-	Model    string    `json:"model"`
-	Messages []message `json:"messages"`
+// splitThinkBlock отделяет рассуждения, которые некоторые модели (например, deepseek-r1)
+// пишут прямо в content внутри <think>...</think>, от самого ответа.
+func splitThinkBlock(content string) (reasoning, answer string) {
+	trimmed := strings.TrimSpace(content)
+	if !strings.HasPrefix(trimmed, "<think>") {
+		return "", content
+	}
+	end := strings.Index(trimmed, "</think>")
+	if end < 0 {
+		return "", content
+	}
+	reasoning = strings.TrimSpace(trimmed[len("<think>"):end])
+	answer = strings.TrimSpace(trimmed[end+len("</think>"):])
+	return reasoning, answer
 }
 
-type message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+type openRouterRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	MaxTokens   *int      `json:"max_tokens,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+	// Provider не отправляется, если маршрутизация не настроена.
+	Provider *ProviderPreferences `json:"provider,omitempty"`
 }
 
 type openRouterResponse struct {
+	// Model фактическая модель: при маршрутизации она может отличаться от запрошенной.
+	Model   string `json:"model"`
 	Choices []struct {
-		Message message `json:"message"`
+		Message openRouterMessage `json:"message"`
 	} `json:"choices"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+		// Cost стоимость в кредитах OpenRouter; приходит, если включен учет usage.
+		Cost float64 `json:"cost"`
+	} `json:"usage"`
 }
 
-type transientError struct {
-	status int
-	body   string
-}
-
-func (e *transientError) Error() string {
-	return fmt.Sprintf("transient status %d: %s", e.status, e.body)
+// openRouterMessage сообщение ответа; Reasoning заполняют модели с рассуждениями.
+type openRouterMessage struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	Reasoning string `json:"reasoning"`
 }
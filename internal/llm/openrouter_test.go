@@ -0,0 +1,344 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aiadvent/internal/config"
+)
+
+func TestOpenRouterChatWithMessagesKeepsRoles(t *testing.T) {
+	var got openRouterRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"answer"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenRouterClient(config.OpenRouterConfig{BaseURL: server.URL, DefaultModel: "test-model"}, server.Client(), nil)
+
+	history := []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "first"},
+		{Role: RoleAssistant, Content: "reply"},
+		{Role: RoleUser, Content: "second"},
+	}
+	answer, err := client.ChatWithMessages(context.Background(), "", history)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer != "answer" {
+		t.Fatalf("unexpected answer: %q", answer)
+	}
+	if got.Model != "test-model" {
+		t.Fatalf("expected default model, got %q", got.Model)
+	}
+	if len(got.Messages) != len(history) {
+		t.Fatalf("expected %d messages, got %d", len(history), len(got.Messages))
+	}
+	for i := range history {
+		if got.Messages[i] != history[i] {
+			t.Fatalf("message %d mismatch: got %+v want %+v", i, got.Messages[i], history[i])
+		}
+	}
+}
+
+func TestOpenRouterChatWithMessagesSendsSamplingParams(t *testing.T) {
+	var raw map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"answer"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenRouterClient(config.OpenRouterConfig{BaseURL: server.URL, DefaultModel: "test-model"}, server.Client(), nil)
+	messages := []Message{{Role: RoleUser, Content: "q"}}
+
+	if _, err := client.ChatWithMessages(context.Background(), "", messages,
+		WithTemperature(0.2), WithMaxTokens(256), WithTopP(0.9)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if raw["temperature"] != 0.2 || raw["max_tokens"] != float64(256) || raw["top_p"] != 0.9 {
+		t.Fatalf("unexpected params in body: %v", raw)
+	}
+
+	raw = nil
+	if _, err := client.ChatWithMessages(context.Background(), "", messages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, key := range []string{"temperature", "max_tokens", "top_p"} {
+		if _, ok := raw[key]; ok {
+			t.Fatalf("expected %s to be omitted when not set, body: %v", key, raw)
+		}
+	}
+}
+
+func TestOpenRouterRetryStopsWhenDeadlineTooClose(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "upstream overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewOpenRouterClient(config.OpenRouterConfig{
+		BaseURL:      server.URL,
+		DefaultModel: "test-model",
+		RetryCount:   2,
+		RetryBackoff: 500 * time.Millisecond,
+	}, server.Client(), nil)
+
+	// Пауза перед повтором 500ms, а до дедлайна меньше — ждать бессмысленно.
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.ChatCompletion(ctx, "q", "")
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected upstream error instead of deadline, got %v", err)
+	}
+	var te *transientError
+	if !errors.As(err, &te) || te.status != http.StatusServiceUnavailable {
+		t.Fatalf("expected transient 503 error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected early return, took %v", elapsed)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls)
+	}
+}
+
+func TestOpenRouterUsesConfiguredBackoff(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "upstream overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"answer"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenRouterClient(config.OpenRouterConfig{
+		BaseURL:      server.URL,
+		DefaultModel: "test-model",
+		RetryCount:   1,
+		RetryBackoff: 80 * time.Millisecond,
+	}, server.Client(), nil)
+
+	start := time.Now()
+	if _, err := client.ChatCompletion(context.Background(), "q", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected one retry, got %d calls", calls)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Fatalf("expected configured backoff of 80ms between attempts, took %v", elapsed)
+	}
+
+	calls = 0
+	noRetry := NewOpenRouterClient(config.OpenRouterConfig{BaseURL: server.URL, DefaultModel: "test-model"}, server.Client(), nil)
+	if _, err := noRetry.ChatCompletion(context.Background(), "q", ""); err == nil {
+		t.Fatalf("expected error without retries")
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single attempt with RetryCount=0, got %d", calls)
+	}
+}
+
+func TestOpenRouterEmptyChoices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenRouterClient(config.OpenRouterConfig{BaseURL: server.URL, DefaultModel: "test-model"}, server.Client(), nil)
+	_, err := client.ChatCompletion(context.Background(), "q", "")
+	if !errors.Is(err, ErrEmptyResponse) {
+		t.Fatalf("expected ErrEmptyResponse, got %v", err)
+	}
+}
+
+func TestOpenRouterReasoning(t *testing.T) {
+	responses := map[string]string{
+		"field": `{"choices":[{"message":{"role":"assistant","content":"42","reasoning":"6 * 7 = 42"}}]}`,
+		"think": `{"choices":[{"message":{"role":"assistant","content":"<think>6 * 7 = 42</think>\n\n42"}}]}`,
+	}
+	for name, body := range responses {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			cfg := config.OpenRouterConfig{BaseURL: server.URL, DefaultModel: "deepseek/deepseek-r1"}
+			answer, err := NewOpenRouterClient(cfg, server.Client(), nil).ChatCompletion(context.Background(), "q", "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if answer != "42" {
+				t.Fatalf("expected reasoning to be stripped, got %q", answer)
+			}
+
+			cfg.ShowReasoning = true
+			answer, err = NewOpenRouterClient(cfg, server.Client(), nil).ChatCompletion(context.Background(), "q", "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(answer, "6 * 7 = 42") || !strings.HasSuffix(answer, "Ответ:\n42") {
+				t.Fatalf("expected reasoning to be shown before the answer, got %q", answer)
+			}
+		})
+	}
+}
+
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestOpenRouterLogsCompletionLatency(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "busy", http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"answer"}}]}`))
+	}))
+	defer server.Close()
+
+	handler := &recordingHandler{}
+	client := NewOpenRouterClient(config.OpenRouterConfig{BaseURL: server.URL, RetryCount: 2}, server.Client(), slog.New(handler))
+	if _, err := client.ChatCompletion(context.Background(), "question", "test-model"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if len(handler.records) != 2 {
+		t.Fatalf("expected retry warning and completion record, got %d records", len(handler.records))
+	}
+	if handler.records[0].Level != slog.LevelWarn {
+		t.Fatalf("expected retry to be logged at warn, got %v", handler.records[0].Level)
+	}
+
+	completion := handler.records[1]
+	if completion.Level != slog.LevelInfo || completion.Message != "openrouter completion" {
+		t.Fatalf("unexpected completion record: %v %q", completion.Level, completion.Message)
+	}
+	attrs := map[string]slog.Value{}
+	completion.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	if attrs["model"].String() != "test-model" || attrs["attempts"].Int64() != 2 ||
+		attrs["prompt_len"].Int64() != int64(len("question")) || attrs["completion_len"].Int64() != int64(len("answer")) {
+		t.Fatalf("unexpected completion attrs: %v", attrs)
+	}
+	if _, ok := attrs["duration_ms"]; !ok {
+		t.Fatalf("duration_ms is missing")
+	}
+}
+
+func TestOpenRouterSendsAttributionHeaders(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"answer"}}]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.OpenRouterConfig{
+		BaseURL:      server.URL,
+		DefaultModel: "test-model",
+		AppURL:       "https://example.com/bot",
+		AppName:      "aiadvent",
+	}
+	client := NewOpenRouterClient(cfg, server.Client(), nil)
+	if _, err := client.ChatCompletion(context.Background(), "q", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := headers.Get("HTTP-Referer"); got != "https://example.com/bot" {
+		t.Fatalf("unexpected HTTP-Referer: %q", got)
+	}
+	if got := headers.Get("X-Title"); got != "aiadvent" {
+		t.Fatalf("unexpected X-Title: %q", got)
+	}
+}
+
+func TestOpenRouterProviderPreferences(t *testing.T) {
+	var raw map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw = nil
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"answer"}}]}`))
+	}))
+	defer server.Close()
+
+	messages := []Message{{Role: RoleUser, Content: "q"}}
+
+	plain := NewOpenRouterClient(config.OpenRouterConfig{BaseURL: server.URL, DefaultModel: "m"}, server.Client(), nil)
+	if _, err := plain.ChatWithMessages(context.Background(), "", messages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := raw["provider"]; ok {
+		t.Fatalf("provider must be omitted by default, body: %s", raw["provider"])
+	}
+
+	allow := false
+	cfg := config.OpenRouterConfig{
+		BaseURL:        server.URL,
+		DefaultModel:   "m",
+		ProviderOrder:  []string{"Anthropic", "Together"},
+		AllowFallbacks: &allow,
+	}
+	pinned := NewOpenRouterClient(cfg, server.Client(), nil)
+	if _, err := pinned.ChatWithMessages(context.Background(), "", messages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(raw["provider"]); got != `{"order":["Anthropic","Together"],"allow_fallbacks":false}` {
+		t.Fatalf("unexpected provider preferences: %s", got)
+	}
+
+	// Опция запроса перекрывает настройки из конфигурации.
+	if _, err := pinned.ChatWithMessages(context.Background(), "", messages, WithProvider(ProviderPreferences{Order: []string{"OpenAI"}})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(raw["provider"]); got != `{"order":["OpenAI"]}` {
+		t.Fatalf("unexpected per-request provider preferences: %s", got)
+	}
+}
@@ -0,0 +1,50 @@
+package llm
+
+// ChatParams необязательные параметры генерации. Незаданные (nil) поля не отправляются,
+// и провайдер использует свои значения по умолчанию.
+type ChatParams struct {
+	Temperature *float64
+	MaxTokens   *int
+	TopP        *float64
+	// Provider переопределяет маршрутизацию OpenRouter, заданную в конфигурации.
+	Provider *ProviderPreferences
+}
+
+// ProviderPreferences поле provider запроса OpenRouter: какие upstream-провайдеры
+// и в каком порядке обслуживают модель.
+type ProviderPreferences struct {
+	Order             []string `json:"order,omitempty"`
+	AllowFallbacks    *bool    `json:"allow_fallbacks,omitempty"`
+	RequireParameters *bool    `json:"require_parameters,omitempty"`
+}
+
+func (p ProviderPreferences) isZero() bool {
+	return len(p.Order) == 0 && p.AllowFallbacks == nil && p.RequireParameters == nil
+}
+
+// ChatOption задает один из параметров ChatParams.
+type ChatOption func(*ChatParams)
+
+func WithTemperature(temperature float64) ChatOption {
+	return func(p *ChatParams) { p.Temperature = &temperature }
+}
+
+func WithMaxTokens(maxTokens int) ChatOption {
+	return func(p *ChatParams) { p.MaxTokens = &maxTokens }
+}
+
+func WithTopP(topP float64) ChatOption {
+	return func(p *ChatParams) { p.TopP = &topP }
+}
+
+func WithProvider(prefs ProviderPreferences) ChatOption {
+	return func(p *ChatParams) { p.Provider = &prefs }
+}
+
+func applyChatOptions(opts []ChatOption) ChatParams {
+	var params ChatParams
+	for _, opt := range opts {
+		opt(&params)
+	}
+	return params
+}
@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"aiadvent/internal/requestid"
+)
+
+// withRetries выполняет call, повторяя его при transientError с линейно растущей паузой.
+// Если до дедлайна ctx не хватает времени на паузу, повторов больше не будет и
+// возвращается последняя ошибка провайдера, а не менее информативный context.DeadlineExceeded.
+func withRetries(ctx context.Context, retryCount int, backoff time.Duration, logger *slog.Logger, provider string, call func() (string, error)) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt <= retryCount; attempt++ {
+		answer, err := call()
+		if err == nil {
+			return answer, nil
+		}
+		if !shouldRetry(err) || attempt == retryCount {
+			return "", err
+		}
+		lastErr = err
+		wait := backoff * time.Duration(attempt+1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return "", fmt.Errorf("%s request failed, no time left for retry: %w", provider, err)
+		}
+		if logger != nil {
+			logger.Warn(provider+" retry",
+				requestid.Attr(ctx),
+				slog.Int("attempt", attempt+1),
+				slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return "", fmt.Errorf("%s request failed: %w", provider, lastErr)
+}
+
+func shouldRetry(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var te *transientError
+	return errors.As(err, &te)
+}
+
+type transientError struct {
+	status int
+	body   string
+}
+
+func (e *transientError) Error() string {
+	return fmt.Sprintf("transient status %d: %s", e.status, e.body)
+}
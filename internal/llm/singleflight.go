@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// SingleflightClient объединяет одинаковые одновременные запросы к Client:
+// пока запрос с тем же ключом (модель, сообщения и параметры генерации) выполняется, повторные вызовы
+// ждут его результата, а не идут к провайдеру сами.
+type SingleflightClient struct {
+	client Client
+	group  singleflight.Group
+}
+
+func NewSingleflightClient(client Client) *SingleflightClient {
+	return &SingleflightClient{client: client}
+}
+
+func (c *SingleflightClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	key := cacheKey(model, []Message{{Role: RoleUser, Content: prompt}}, ChatParams{})
+	return c.do(ctx, key, func(ctx context.Context) (string, error) {
+		return c.client.ChatCompletion(ctx, prompt, model)
+	})
+}
+
+func (c *SingleflightClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	key := cacheKey(model, messages, applyChatOptions(opts))
+	return c.do(ctx, key, func(ctx context.Context) (string, error) {
+		return c.client.ChatWithMessages(ctx, model, messages, opts...)
+	})
+}
+
+// do выполняет общий запрос без отмены контекста первого вызывающего: иначе отмена
+// одного из них оборвала бы ответ для всех ожидающих. Дедлайн первого вызывающего
+// сохраняется, чтобы ретраи и резервные модели не работали дольше, чем его ждут.
+// Каждый вызывающий перестает ждать по своему ctx.
+func (c *SingleflightClient) do(ctx context.Context, key string, call func(context.Context) (string, error)) (string, error) {
+	ch := c.group.DoChan(key, func() (any, error) {
+		shared := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			shared, cancel = context.WithDeadline(shared, deadline)
+			defer cancel()
+		}
+		return call(shared)
+	})
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	}
+}
@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aiadvent/internal/config"
+)
+
+type blockingClient struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (c *blockingClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return c.ChatWithMessages(ctx, model, nil)
+}
+
+func (c *blockingClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	c.calls.Add(1)
+	<-c.release
+	return "shared answer", nil
+}
+
+func TestSingleflightClientSharesConcurrentCalls(t *testing.T) {
+	inner := &blockingClient{release: make(chan struct{})}
+	client := NewSingleflightClient(inner)
+
+	const n = 10
+	var (
+		wg      sync.WaitGroup
+		started sync.WaitGroup
+		answers = make([]string, n)
+	)
+	started.Add(n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			started.Done()
+			answers[i], _ = client.ChatCompletion(context.Background(), "вопрос", "model")
+		}(i)
+	}
+	started.Wait()
+	// Даем всем горутинам встать в ожидание общего запроса.
+	time.Sleep(50 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	if got := inner.calls.Load(); got != 1 {
+		t.Fatalf("expected one upstream call, got %d", got)
+	}
+	for i, answer := range answers {
+		if answer != "shared answer" {
+			t.Fatalf("caller %d got %q", i, answer)
+		}
+	}
+}
+
+func TestSingleflightClientCallerCancellation(t *testing.T) {
+	inner := &blockingClient{release: make(chan struct{})}
+	defer close(inner.release)
+	client := NewSingleflightClient(inner)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.ChatCompletion(ctx, "вопрос", ""); err != context.DeadlineExceeded {
+		t.Fatalf("expected caller deadline error, got %v", err)
+	}
+}
+
+type deadlineClient struct {
+	deadline chan time.Time
+}
+
+func (c *deadlineClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return c.ChatWithMessages(ctx, model, nil)
+}
+
+func (c *deadlineClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	deadline, _ := ctx.Deadline()
+	c.deadline <- deadline
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestSingleflightClientKeepsCallerDeadline(t *testing.T) {
+	inner := &deadlineClient{deadline: make(chan time.Time, 1)}
+	client := NewSingleflightClient(inner)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	go client.ChatCompletion(ctx, "вопрос", "")
+
+	select {
+	case got := <-inner.deadline:
+		if !got.Equal(want) {
+			t.Fatalf("expected shared call deadline %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("upstream was not called")
+	}
+}
+
+// Стек как в cmd/app: дедлайн обработки update должен дойти до ретраев провайдера
+// сквозь SingleflightClient и TrackedClient.
+func TestDeadlineReachesProviderRetriesThroughDecorators(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "upstream overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	provider := NewOpenRouterClient(config.OpenRouterConfig{
+		BaseURL:      server.URL,
+		DefaultModel: "test-model",
+		RetryCount:   2,
+		RetryBackoff: 500 * time.Millisecond,
+	}, server.Client(), nil)
+	client := NewSingleflightClient(NewTrackedClient(provider))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.ChatCompletion(ctx, "q", "")
+	var te *transientError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected provider error before the deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected early return, took %v", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected a single attempt, got %d", got)
+	}
+}
+
+func TestChatOptionsReachProviderThroughDecorators(t *testing.T) {
+	var raw map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"answer"}}]}`))
+	}))
+	defer server.Close()
+
+	var client Client = NewOpenRouterClient(config.OpenRouterConfig{BaseURL: server.URL, DefaultModel: "test-model"}, server.Client(), nil)
+	client = NewFallbackClient(client, "", []string{"backup"}, nil)
+	client = NewSingleflightClient(NewTrackedClient(client))
+	client = NewCachedClient(client, 10, time.Minute)
+
+	messages := []Message{{Role: RoleUser, Content: "q"}}
+	if _, err := client.ChatWithMessages(context.Background(), "", messages, WithTemperature(0.2), WithMaxTokens(64)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if raw["temperature"] != 0.2 || raw["max_tokens"] != float64(64) {
+		t.Fatalf("expected params to reach the provider, got %v", raw)
+	}
+}
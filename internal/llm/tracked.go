@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// trackedFailureThreshold после стольких сбоев провайдера подряд LLM считается недоступной.
+	trackedFailureThreshold = 3
+	// trackedFailureWindow сбои старше этого окна не учитываются: без запросов
+	// недоступность не может длиться вечно.
+	trackedFailureWindow = 5 * time.Minute
+)
+
+// TrackedClient оборачивает Client и считает сбои провайдера подряд, чтобы health-check
+// мог судить о доступности LLM без собственных запросов к API. Сбоем считаются только
+// ошибки сети и ответы 429/5xx: пустой ответ, неизвестная модель или другой 4xx
+// говорят о конкретном запросе, а не о доступности провайдера.
+type TrackedClient struct {
+	Client
+
+	mu          sync.RWMutex
+	failures    int
+	lastFailure time.Time
+	lastErr     error
+	now         func() time.Time
+}
+
+func NewTrackedClient(client Client) *TrackedClient {
+	return &TrackedClient{Client: client, now: time.Now}
+}
+
+func (c *TrackedClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	answer, err := c.Client.ChatCompletion(ctx, prompt, model)
+	c.record(err)
+	return answer, err
+}
+
+func (c *TrackedClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	answer, err := c.Client.ChatWithMessages(ctx, model, messages, opts...)
+	c.record(err)
+	return answer, err
+}
+
+// Probe возвращает ошибку, если последние trackedFailureThreshold вызовов подряд
+// завершились сбоем провайдера и последний из них был не раньше trackedFailureWindow.
+func (c *TrackedClient) Probe(ctx context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.failures >= trackedFailureThreshold && c.now().Sub(c.lastFailure) < trackedFailureWindow {
+		return fmt.Errorf("%d llm calls in a row failed, last at %s: %w",
+			c.failures, c.lastFailure.Format(time.RFC3339), c.lastErr)
+	}
+	return nil
+}
+
+func (c *TrackedClient) record(err error) {
+	if err != nil && !isProviderFailure(err) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.failures++
+		c.lastFailure = c.now()
+		c.lastErr = err
+		return
+	}
+	c.failures = 0
+}
+
+// isProviderFailure отличает недоступность провайдера (сеть, 429, 5xx) от ошибок
+// конкретного запроса и от отмены или таймаута вызывающей стороны.
+func isProviderFailure(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var te *transientError
+	if errors.As(err, &te) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
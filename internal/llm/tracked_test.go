@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type errClient struct {
+	err error
+}
+
+func (c *errClient) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return c.ChatWithMessages(ctx, model, nil)
+}
+
+func (c *errClient) ChatWithMessages(ctx context.Context, model string, messages []Message, opts ...ChatOption) (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return "ok", nil
+}
+
+func TestTrackedClientIgnoresRequestErrors(t *testing.T) {
+	inner := &errClient{}
+	client := NewTrackedClient(inner)
+	ctx := context.Background()
+
+	for _, err := range []error{
+		ErrEmptyResponse,
+		ErrInvalidModel,
+		fmt.Errorf("unexpected status %d: bad request", http.StatusBadRequest),
+		context.DeadlineExceeded,
+	} {
+		inner.err = err
+		for i := 0; i < trackedFailureThreshold; i++ {
+			client.ChatCompletion(ctx, "q", "")
+		}
+		if probeErr := client.Probe(ctx); probeErr != nil {
+			t.Fatalf("%v must not mark llm unavailable: %v", err, probeErr)
+		}
+	}
+}
+
+func TestTrackedClientFailsAfterConsecutiveProviderFailures(t *testing.T) {
+	inner := &errClient{}
+	client := NewTrackedClient(inner)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	inner.err = fmt.Errorf("openrouter request failed: %w", &transientError{status: http.StatusBadGateway})
+	for i := 0; i < trackedFailureThreshold-1; i++ {
+		client.ChatCompletion(ctx, "q", "")
+	}
+	if err := client.Probe(ctx); err != nil {
+		t.Fatalf("expected single failures to be tolerated, got %v", err)
+	}
+
+	client.ChatCompletion(ctx, "q", "")
+	err := client.Probe(ctx)
+	var te *transientError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected probe to fail with the provider error, got %v", err)
+	}
+
+	// Без новых запросов сбой устаревает.
+	now = now.Add(trackedFailureWindow)
+	if err := client.Probe(ctx); err != nil {
+		t.Fatalf("expected stale failures to be ignored, got %v", err)
+	}
+
+	// Успешный вызов сбрасывает счетчик.
+	now = now.Add(-trackedFailureWindow)
+	inner.err = nil
+	client.ChatCompletion(ctx, "q", "")
+	if err := client.Probe(ctx); err != nil {
+		t.Fatalf("expected success to reset failures, got %v", err)
+	}
+}
@@ -3,12 +3,15 @@ package middleware
 import (
 	"net/http"
 
+	"aiadvent/internal/requestid"
+
 	"github.com/google/uuid"
 )
 
-const headerRequestID = "X-Request-ID"
+const headerRequestID = requestid.Header
 
-// RequestID проставляет идентификатор запроса, если он не был задан.
+// RequestID проставляет идентификатор запроса, если он не был задан,
+// и кладет его в context для обработчиков.
 func RequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		reqID := r.Header.Get(headerRequestID)
@@ -17,6 +20,6 @@ func RequestID(next http.Handler) http.Handler {
 			r.Header.Set(headerRequestID, reqID)
 		}
 		w.Header().Set(headerRequestID, reqID)
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), reqID)))
 	})
 }
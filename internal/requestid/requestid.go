@@ -0,0 +1,32 @@
+// Package requestid переносит идентификатор входящего запроса через context,
+// чтобы логи фоновой обработки можно было связать с исходным вебхуком.
+package requestid
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Header заголовок, в котором идентификатор приходит и возвращается клиенту.
+const Header = "X-Request-ID"
+
+type ctxKey struct{}
+
+// NewContext возвращает копию ctx с идентификатором запроса.
+func NewContext(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext возвращает идентификатор запроса или пустую строку.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Attr slog-атрибут request_id для логов.
+func Attr(ctx context.Context) slog.Attr {
+	return slog.String("request_id", FromContext(ctx))
+}
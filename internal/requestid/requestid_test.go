@@ -0,0 +1,19 @@
+package requestid
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContextRoundTrip(t *testing.T) {
+	ctx := NewContext(context.Background(), "req-1")
+	if got := FromContext(ctx); got != "req-1" {
+		t.Fatalf("unexpected request id: %q", got)
+	}
+	if got := FromContext(context.Background()); got != "" {
+		t.Fatalf("expected empty id for bare context, got %q", got)
+	}
+	if got := Attr(ctx); got.Key != "request_id" || got.Value.String() != "req-1" {
+		t.Fatalf("unexpected attr: %v", got)
+	}
+}
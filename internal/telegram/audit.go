@@ -0,0 +1,51 @@
+package telegram
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// auditMessage постоянный текст записи аудита, по нему записи отбираются из общего лога.
+const auditMessage = "audit"
+
+// AuditEntry запись о выполненной команде. Аргументы команды не сохраняются:
+// в них бывают пароли и тексты вопросов.
+type AuditEntry struct {
+	UserID     int64
+	Username   string
+	ChatID     int64
+	Command    string
+	Time       time.Time
+	Authorized bool
+}
+
+// AuditSink дополнительный приемник записей аудита, например база или внешний сервис.
+type AuditSink interface {
+	Record(ctx context.Context, entry AuditEntry)
+}
+
+// audit пишет запись о команде в лог и, если задан, в AuditSink. Сессия проверяется
+// без продления: запись аудита не должна считаться активностью пользователя.
+func (h *WebhookHandler) audit(ctx context.Context, msg *Message, cmd string) {
+	_, authorized := h.auth.Session(ctx, msg.From.ID)
+	entry := AuditEntry{
+		UserID:     msg.From.ID,
+		Username:   msg.From.Username,
+		ChatID:     msg.Chat.ID,
+		Command:    cmd,
+		Time:       time.Now(),
+		Authorized: authorized,
+	}
+
+	h.log(ctx).Info(auditMessage,
+		slog.Int64("user_id", entry.UserID),
+		slog.String("username", entry.Username),
+		slog.Int64("chat_id", entry.ChatID),
+		slog.String("command", entry.Command),
+		slog.Bool("authorized", entry.Authorized),
+	)
+	if h.auditSink != nil {
+		h.auditSink.Record(ctx, entry)
+	}
+}
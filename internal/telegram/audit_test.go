@@ -0,0 +1,130 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aiadvent/internal/auth"
+)
+
+type recordingSink struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (s *recordingSink) Record(ctx context.Context, entry AuditEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+func (s *recordingSink) Entries() []AuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]AuditEntry(nil), s.entries...)
+}
+
+// lockedBuffer буфер для лога, в который пишут горутины обработчика.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAuditRecordsCommands(t *testing.T) {
+	var logs lockedBuffer
+	sink := &recordingSink{}
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:      auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:       &stubLLM{answer: "ok"},
+		Bot:       bot,
+		Logger:    slog.New(slog.NewTextHandler(&logs, nil)),
+		AuditSink: sink,
+	})
+
+	sendUpdate(t, handler, 7, "/start")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendUpdate(t, handler, 7, "/login pass")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	sendUpdate(t, handler, 7, "/me")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+
+	entries := sink.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d", len(entries))
+	}
+	want := []struct {
+		command    string
+		authorized bool
+	}{
+		{"/start", false},
+		{"/login", false},
+		{"/me", true},
+	}
+	for i, w := range want {
+		got := entries[i]
+		if got.Command != w.command || got.Authorized != w.authorized || got.UserID != 7 {
+			t.Fatalf("entry %d: expected %s authorized=%v, got %+v", i, w.command, w.authorized, got)
+		}
+		if got.Time.IsZero() {
+			t.Fatalf("entry %d has no timestamp", i)
+		}
+	}
+
+	out := logs.String()
+	if strings.Count(out, "msg=audit") != 3 {
+		t.Fatalf("expected 3 audit log records, got:\n%s", out)
+	}
+	if strings.Contains(out, "pass\"") || strings.Contains(out, "/login pass") {
+		t.Fatalf("audit log must not contain command arguments:\n%s", out)
+	}
+}
+
+func TestAuditDoesNotExtendSlidingSession(t *testing.T) {
+	store := auth.NewMemoryStore()
+	authService := auth.NewServiceWithCredentials([]auth.Credential{{Password: "pass", Role: auth.RoleUser}},
+		200*time.Millisecond, store, auth.WithSlidingExpiry())
+	bot := &stubBot{}
+	sink := &recordingSink{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:      authService,
+		LLM:       &stubLLM{answer: "ok"},
+		Bot:       bot,
+		Logger:    slog.New(slog.NewTextHandler(&lockedBuffer{}, nil)),
+		AuditSink: sink,
+	})
+	if _, err := authService.Login(context.Background(), 7, "pass"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	before, _ := store.Get(7)
+
+	// Сессия продлевается, только если срок сдвигается больше чем на десятую часть ttl.
+	time.Sleep(40 * time.Millisecond)
+	// /start сам авторизацию не проверяет, так что продлить сессию мог бы только аудит.
+	sendUpdate(t, handler, 7, "/start")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+
+	if entries := sink.Entries(); len(entries) != 1 || !entries[0].Authorized {
+		t.Fatalf("expected authorized audit entry, got %+v", entries)
+	}
+	if after, _ := store.Get(7); !after.ExpiresAt.Equal(before.ExpiresAt) {
+		t.Fatalf("expected audit to keep session expiry %v, got %v", before.ExpiresAt, after.ExpiresAt)
+	}
+}
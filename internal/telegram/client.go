@@ -4,62 +4,330 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"aiadvent/internal/config"
 )
 
+const (
+	defaultMaxRetries = 2
+	// maxRetryAfter верхняя граница ожидания по retry_after, чтобы не держать воркер слишком долго.
+	maxRetryAfter = 30 * time.Second
+)
+
 type BotClient interface {
 	SendMessage(ctx context.Context, chatID int64, text string) error
+	// SendReply отправляет сообщение ответом на replyToID, чтобы в группе оно было привязано к вопросу.
+	SendReply(ctx context.Context, chatID, replyToID int64, text string) error
+	// SendMarkdown отправляет text с parse_mode Markdown; replyToID == 0 — обычное сообщение.
+	SendMarkdown(ctx context.Context, chatID, replyToID int64, text string) error
+	GetMe(ctx context.Context) (User, error)
+	// SendDocument загружает файл в чат (multipart sendDocument); caption необязателен.
+	SendDocument(ctx context.Context, chatID int64, filename string, data io.Reader, caption string) error
+	// SetWebhook регистрирует url вебхука; secret Telegram будет присылать в заголовке
+	// X-Telegram-Bot-Api-Secret-Token. Пустой secret и maxConnections <= 0 не отправляются.
+	SetWebhook(ctx context.Context, url, secret string, maxConnections int) error
+	// DeleteWebhook снимает вебхук; dropPending отбрасывает накопившиеся обновления.
+	DeleteWebhook(ctx context.Context, dropPending bool) error
+	GetWebhookInfo(ctx context.Context) (WebhookInfo, error)
 }
 
 type HTTPBotClient struct {
 	token      string
 	baseURL    string
 	httpClient *http.Client
+	// maxRetries сколько раз повторять запрос после ответа 429 Too Many Requests.
+	maxRetries int
+	// retryAfterUnit единица retry_after (секунды в Bot API); в тестах уменьшается.
+	retryAfterUnit time.Duration
 }
 
 func NewClient(cfg config.TelegramConfig, httpClient *http.Client) BotClient {
 	return &HTTPBotClient{
-		token:      cfg.BotToken,
-		baseURL:    cfg.APIBaseURL,
-		httpClient: httpClient,
+		token:          cfg.BotToken,
+		baseURL:        cfg.APIBaseURL,
+		httpClient:     httpClient,
+		maxRetries:     defaultMaxRetries,
+		retryAfterUnit: time.Second,
 	}
 }
 
 func (c *HTTPBotClient) SendMessage(ctx context.Context, chatID int64, text string) error {
-	payload := sendMessageRequest{
+	return c.sendMessage(ctx, sendMessageRequest{
 		ChatID: chatID,
 		Text:   text,
+	})
+}
+
+func (c *HTTPBotClient) SendReply(ctx context.Context, chatID, replyToID int64, text string) error {
+	return c.sendMessage(ctx, sendMessageRequest{
+		ChatID:           chatID,
+		Text:             text,
+		ReplyToMessageID: replyToID,
+	})
+}
+
+func (c *HTTPBotClient) SendMarkdown(ctx context.Context, chatID, replyToID int64, text string) error {
+	return c.sendMessage(ctx, sendMessageRequest{
+		ChatID:           chatID,
+		Text:             text,
+		ParseMode:        "Markdown",
+		ReplyToMessageID: replyToID,
+	})
+}
+
+func (c *HTTPBotClient) sendMessage(ctx context.Context, payload sendMessageRequest) error {
+	_, err := c.callJSON(ctx, "sendMessage", payload)
+	return err
+}
+
+func (c *HTTPBotClient) SetWebhook(ctx context.Context, url, secret string, maxConnections int) error {
+	respBody, err := c.callJSON(ctx, "setWebhook", setWebhookRequest{
+		URL:            url,
+		SecretToken:    secret,
+		MaxConnections: maxConnections,
+	})
+	if err != nil {
+		return err
 	}
-	body, err := json.Marshal(payload)
+	return checkOK("setWebhook", respBody)
+}
+
+func (c *HTTPBotClient) DeleteWebhook(ctx context.Context, dropPending bool) error {
+	respBody, err := c.callJSON(ctx, "deleteWebhook", deleteWebhookRequest{DropPendingUpdates: dropPending})
 	if err != nil {
-		return fmt.Errorf("marshal telegram request: %w", err)
+		return err
 	}
+	return checkOK("deleteWebhook", respBody)
+}
 
-	url := fmt.Sprintf("%s/bot%s/sendMessage", c.baseURL, c.token)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+func (c *HTTPBotClient) GetWebhookInfo(ctx context.Context) (WebhookInfo, error) {
+	respBody, err := c.call(ctx, "getWebhookInfo", "", nil)
 	if err != nil {
-		return fmt.Errorf("build telegram request: %w", err)
+		return WebhookInfo{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	var parsed webhookInfoResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return WebhookInfo{}, fmt.Errorf("decode telegram response: %w", err)
+	}
+	if !parsed.OK {
+		return WebhookInfo{}, parseAPIError("getWebhookInfo", http.StatusOK, respBody)
+	}
+	return parsed.Result, nil
+}
+
+// callJSON отправляет payload методу Bot API в теле JSON.
+func (c *HTTPBotClient) callJSON(ctx context.Context, method string, payload any) ([]byte, error) {
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("execute telegram request: %w", err)
+		return nil, fmt.Errorf("marshal telegram request: %w", err)
 	}
-	defer resp.Body.Close()
-	respBody, _ := io.ReadAll(resp.Body)
+	return c.call(ctx, method, "application/json", body)
+}
 
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("telegram api status %d: %s", resp.StatusCode, string(respBody))
+// checkOK проверяет поле ok в успешном по HTTP-статусу ответе.
+func checkOK(method string, respBody []byte) error {
+	var parsed apiErrorResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return fmt.Errorf("decode telegram response: %w", err)
+	}
+	if !parsed.OK {
+		return parseAPIError(method, http.StatusOK, respBody)
 	}
 	return nil
 }
 
+func (c *HTTPBotClient) SendDocument(ctx context.Context, chatID int64, filename string, data io.Reader, caption string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("chat_id", strconv.FormatInt(chatID, 10)); err != nil {
+		return fmt.Errorf("build telegram form: %w", err)
+	}
+	if caption != "" {
+		if err := form.WriteField("caption", caption); err != nil {
+			return fmt.Errorf("build telegram form: %w", err)
+		}
+	}
+	part, err := form.CreateFormFile("document", filename)
+	if err != nil {
+		return fmt.Errorf("build telegram form: %w", err)
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return fmt.Errorf("read document: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("build telegram form: %w", err)
+	}
+
+	_, err = c.call(ctx, "sendDocument", form.FormDataContentType(), body.Bytes())
+	return err
+}
+
+// GetMe возвращает информацию о боте; используется как легкая проверка доступности API.
+func (c *HTTPBotClient) GetMe(ctx context.Context) (User, error) {
+	respBody, err := c.call(ctx, "getMe", "", nil)
+	if err != nil {
+		return User{}, err
+	}
+
+	var parsed getMeResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return User{}, fmt.Errorf("decode telegram response: %w", err)
+	}
+	if !parsed.OK {
+		return User{}, parseAPIError("getMe", http.StatusOK, respBody)
+	}
+	return parsed.Result, nil
+}
+
+// call выполняет метод Bot API и возвращает тело успешного ответа. Без тела запрос
+// уходит GET-ом. На 429 запрос повторяется после паузы из parameters.retry_after
+// (или заголовка Retry-After), если она укладывается в maxRetryAfter и дедлайн ctx.
+func (c *HTTPBotClient) call(ctx context.Context, method, contentType string, body []byte) ([]byte, error) {
+	url := fmt.Sprintf("%s/bot%s/%s", c.baseURL, c.token, method)
+	for attempt := 0; ; attempt++ {
+		httpMethod := http.MethodPost
+		var reader io.Reader
+		if body == nil {
+			httpMethod = http.MethodGet
+		} else {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, httpMethod, url, reader)
+		if err != nil {
+			return nil, fmt.Errorf("build telegram request: %w", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("execute telegram request: %w", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 {
+			return respBody, nil
+		}
+		statusErr := parseAPIError(method, resp.StatusCode, respBody)
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= c.maxRetries {
+			return nil, statusErr
+		}
+
+		wait := c.retryAfter(resp, statusErr)
+		if wait > maxRetryAfter {
+			return nil, statusErr
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return nil, statusErr
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryAfter берет паузу из тела ошибки Bot API, затем из заголовка Retry-After.
+func (c *HTTPBotClient) retryAfter(resp *http.Response, apiErr *TelegramAPIError) time.Duration {
+	if apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * c.retryAfterUnit
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * c.retryAfterUnit
+	}
+	return c.retryAfterUnit
+}
+
+// TelegramAPIError ошибка Bot API с кодом и описанием из ответа,
+// например 400 "Bad Request: message is not modified".
+type TelegramAPIError struct {
+	Method      string
+	StatusCode  int
+	ErrorCode   int
+	Description string
+	// RetryAfter пауза в секундах из parameters.retry_after (для 429).
+	RetryAfter int
+}
+
+func (e *TelegramAPIError) Error() string {
+	return fmt.Sprintf("telegram %s: status %d: %s", e.Method, e.StatusCode, e.Description)
+}
+
+// IsNotModified сообщает, что Telegram отклонил правку, потому что текст не изменился.
+// Такую ошибку можно считать успехом.
+func IsNotModified(err error) bool {
+	var apiErr *TelegramAPIError
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "message is not modified")
+}
+
+// IsParseError сообщает, что Telegram не смог разобрать разметку сообщения
+// ("Bad Request: can't parse entities"). Такое сообщение можно отправить простым текстом.
+func IsParseError(err error) bool {
+	var apiErr *TelegramAPIError
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "can't parse entities")
+}
+
+// parseAPIError разбирает конверт ошибки Bot API. Если тело не JSON
+// (например, ответ прокси), описанием становится само тело.
+func parseAPIError(method string, status int, body []byte) *TelegramAPIError {
+	apiErr := &TelegramAPIError{Method: method, StatusCode: status, ErrorCode: status, Description: string(body)}
+	var parsed apiErrorResponse
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Description != "" {
+		apiErr.Description = parsed.Description
+		if parsed.ErrorCode != 0 {
+			apiErr.ErrorCode = parsed.ErrorCode
+		}
+		apiErr.RetryAfter = parsed.Parameters.RetryAfter
+	}
+	return apiErr
+}
+
+// apiErrorResponse конверт ошибки Bot API.
+type apiErrorResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
 type sendMessageRequest struct {
-	ChatID int64  `json:"chat_id"`
-	Text   string `json:"text"`
+	ChatID           int64  `json:"chat_id"`
+	Text             string `json:"text"`
+	ParseMode        string `json:"parse_mode,omitempty"`
+	ReplyToMessageID int64  `json:"reply_to_message_id,omitempty"`
+}
+
+type setWebhookRequest struct {
+	URL            string `json:"url"`
+	SecretToken    string `json:"secret_token,omitempty"`
+	MaxConnections int    `json:"max_connections,omitempty"`
+}
+
+type deleteWebhookRequest struct {
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+}
+
+type webhookInfoResponse struct {
+	OK          bool        `json:"ok"`
+	Description string      `json:"description"`
+	Result      WebhookInfo `json:"result"`
+}
+
+type getMeResponse struct {
+	OK     bool `json:"ok"`
+	Result User `json:"result"`
 }
@@ -0,0 +1,277 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"aiadvent/internal/config"
+)
+
+func TestSendDocumentMultipart(t *testing.T) {
+	var (
+		path     string
+		chatID   string
+		caption  string
+		filename string
+		content  string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse multipart: %v", err)
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+		chatID = r.FormValue("chat_id")
+		caption = r.FormValue("caption")
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			t.Errorf("form file: %v", err)
+			http.Error(w, "no document", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		filename, content = header.Filename, string(data)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+	err := client.SendDocument(context.Background(), 42, "plan.md", strings.NewReader("# План"), "Экспорт")
+	if err != nil {
+		t.Fatalf("send document: %v", err)
+	}
+
+	if path != "/botTOKEN/sendDocument" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+	if chatID != "42" || caption != "Экспорт" {
+		t.Fatalf("unexpected fields: chat_id=%q caption=%q", chatID, caption)
+	}
+	if filename != "plan.md" || content != "# План" {
+		t.Fatalf("unexpected document: %s %q", filename, content)
+	}
+}
+
+func TestSetWebhookPayload(t *testing.T) {
+	var (
+		path    string
+		payload map[string]any
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+	err := client.SetWebhook(context.Background(), "https://example.com/telegram/webhook", "s3cret", 40)
+	if err != nil {
+		t.Fatalf("set webhook: %v", err)
+	}
+
+	if path != "/botTOKEN/setWebhook" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+	if payload["url"] != "https://example.com/telegram/webhook" || payload["secret_token"] != "s3cret" {
+		t.Fatalf("unexpected payload: %v", payload)
+	}
+	if payload["max_connections"] != float64(40) {
+		t.Fatalf("unexpected max_connections: %v", payload["max_connections"])
+	}
+}
+
+func TestSetWebhookNotOK(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: bad webhook"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+	err := client.SetWebhook(context.Background(), "http://insecure", "", 0)
+	if err == nil || !strings.Contains(err.Error(), "bad webhook") {
+		t.Fatalf("expected api error, got %v", err)
+	}
+}
+
+func TestDeleteWebhookDropPending(t *testing.T) {
+	var (
+		path    string
+		payload map[string]any
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+	if err := client.DeleteWebhook(context.Background(), true); err != nil {
+		t.Fatalf("delete webhook: %v", err)
+	}
+	if path != "/botTOKEN/deleteWebhook" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+	if payload["drop_pending_updates"] != true {
+		t.Fatalf("unexpected payload: %v", payload)
+	}
+}
+
+func TestGetWebhookInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botTOKEN/getWebhookInfo" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"url":"https://example.com/hook","pending_update_count":3,"last_error_message":"Connection refused","max_connections":40}}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+	info, err := client.GetWebhookInfo(context.Background())
+	if err != nil {
+		t.Fatalf("get webhook info: %v", err)
+	}
+	if info.URL != "https://example.com/hook" || info.PendingUpdateCount != 3 || info.MaxConnections != 40 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if info.LastErrorMessage != "Connection refused" {
+		t.Fatalf("unexpected last error: %q", info.LastErrorMessage)
+	}
+}
+
+func TestSendDocumentErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"ok":false,"description":"Bad Request: file is empty"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+	err := client.SendDocument(context.Background(), 42, "empty.txt", strings.NewReader(""), "")
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestSendMessageRetriesAfterTooManyRequests(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 3","parameters":{"retry_after":3}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client()).(*HTTPBotClient)
+	client.retryAfterUnit = 10 * time.Millisecond
+
+	start := time.Now()
+	if err := client.SendMessage(context.Background(), 1, "hi"); err != nil {
+		t.Fatalf("send message: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected retry after 429, got %d calls", calls)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("expected to wait retry_after before retrying, waited %v", elapsed)
+	}
+}
+
+func TestSendMessageGivesUpWhenRetryAfterExceedsDeadline(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 5","parameters":{"retry_after":5}}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := client.SendMessage(ctx, 1, "hi")
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Fatalf("expected 429 error, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected no retry past the deadline, got %d calls", calls)
+	}
+}
+
+func TestTelegramAPIErrorEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message is not modified"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+	err := client.SendMessage(context.Background(), 1, "hi")
+
+	var apiErr *TelegramAPIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected TelegramAPIError, got %T: %v", err, err)
+	}
+	if apiErr.Method != "sendMessage" || apiErr.ErrorCode != 400 || apiErr.Description != "Bad Request: message is not modified" {
+		t.Fatalf("unexpected api error: %+v", apiErr)
+	}
+	if !IsNotModified(err) {
+		t.Fatalf("expected not-modified error to be detected")
+	}
+}
+
+func TestSendMarkdownParseError(t *testing.T) {
+	var payload map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 3"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.TelegramConfig{BotToken: "TOKEN", APIBaseURL: srv.URL}, srv.Client())
+	err := client.SendMarkdown(context.Background(), 1, 5, "a *b")
+
+	if payload["parse_mode"] != "Markdown" || payload["reply_to_message_id"] != float64(5) {
+		t.Fatalf("unexpected payload: %v", payload)
+	}
+	if !IsParseError(err) {
+		t.Fatalf("expected parse error to be detected, got %v", err)
+	}
+	if IsParseError(errors.New("can't parse entities")) {
+		t.Fatalf("only typed api errors count as parse errors")
+	}
+}
+
+func TestParseAPIErrorNonJSONBody(t *testing.T) {
+	apiErr := parseAPIError("getMe", http.StatusBadGateway, []byte("<html>bad gateway</html>"))
+	if apiErr.ErrorCode != http.StatusBadGateway || apiErr.Description != "<html>bad gateway</html>" {
+		t.Fatalf("unexpected api error: %+v", apiErr)
+	}
+	if IsNotModified(apiErr) {
+		t.Fatalf("generic error must not be treated as not modified")
+	}
+	if IsNotModified(errors.New("message is not modified")) {
+		t.Fatalf("only typed api errors count as not modified")
+	}
+}
@@ -0,0 +1,50 @@
+package telegram
+
+import (
+	"sync"
+	"time"
+)
+
+// updateDeduper помнит update_id, обработанные за последнее окно window.
+// Telegram повторяет доставку, если не дождался ответа, и без этого одно
+// обновление могло бы обработаться дважды.
+type updateDeduper struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[int64]struct{}
+	// queue хранит id в порядке получения для вытеснения устаревших записей.
+	queue []seenUpdate
+	now   func() time.Time
+}
+
+type seenUpdate struct {
+	id     int64
+	seenAt time.Time
+}
+
+func newUpdateDeduper(window time.Duration) *updateDeduper {
+	return &updateDeduper{
+		window: window,
+		seen:   make(map[int64]struct{}),
+		now:    time.Now,
+	}
+}
+
+// Seen отмечает id и сообщает, встречался ли он уже в пределах окна.
+func (d *updateDeduper) Seen(id int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for len(d.queue) > 0 && now.Sub(d.queue[0].seenAt) > d.window {
+		delete(d.seen, d.queue[0].id)
+		d.queue = d.queue[1:]
+	}
+
+	if _, ok := d.seen[id]; ok {
+		return true
+	}
+	d.seen[id] = struct{}{}
+	d.queue = append(d.queue, seenUpdate{id: id, seenAt: now})
+	return false
+}
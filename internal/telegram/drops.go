@@ -0,0 +1,107 @@
+package telegram
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dropLogInterval как часто писать в лог сводку по отброшенным update.
+const dropLogInterval = time.Minute
+
+// dropCounter считает update, отброшенные из-за занятых воркеров. Вместо предупреждения
+// на каждый отброс в лог раз в interval попадает одна запись с числом отбросов.
+type dropCounter struct {
+	total atomic.Int64
+
+	mu       sync.Mutex
+	pending  int64
+	lastLog  time.Time
+	interval time.Duration
+	now      func() time.Time
+}
+
+func newDropCounter(interval time.Duration) *dropCounter {
+	return &dropCounter{interval: interval, now: time.Now}
+}
+
+// add учитывает отброс. Если с прошлой записи в лог прошло не меньше interval,
+// возвращает число отбросов с тех пор и true — пора писать сводку.
+func (c *dropCounter) add() (int64, bool) {
+	c.total.Add(1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending++
+	now := c.now()
+	if !c.lastLog.IsZero() && now.Sub(c.lastLog) < c.interval {
+		return 0, false
+	}
+	count := c.pending
+	c.pending = 0
+	c.lastLog = now
+	return count, true
+}
+
+// flush возвращает отбросы, не попавшие в последнюю сводку, если с нее прошло
+// не меньше interval. Без этого хвост серии отбросов остался бы в pending, пока
+// не случится следующий отброс, то есть при окончании перегрузки — навсегда.
+func (c *dropCounter) flush() (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pending == 0 {
+		return 0, false
+	}
+	now := c.now()
+	if now.Sub(c.lastLog) < c.interval {
+		return 0, false
+	}
+	count := c.pending
+	c.pending = 0
+	c.lastLog = now
+	return count, true
+}
+
+// Total число отброшенных update с момента запуска.
+func (c *dropCounter) Total() int64 {
+	return c.total.Load()
+}
+
+// noticeLimiter пропускает не больше одного уведомления на чат за interval, чтобы
+// при перегрузке бот не отвечал «Сервис занят» на каждое отброшенное сообщение.
+type noticeLimiter struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	last      map[int64]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newNoticeLimiter(interval time.Duration) *noticeLimiter {
+	return &noticeLimiter{interval: interval, last: make(map[int64]time.Time), now: time.Now}
+}
+
+// allow сообщает, можно ли отправить уведомление в chatID, и запоминает отправку.
+func (l *noticeLimiter) allow(chatID int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	// Раз в interval забываем чаты, которым уведомление снова разрешено.
+	if now.Sub(l.lastSweep) >= l.interval {
+		for id, at := range l.last {
+			if now.Sub(at) >= l.interval {
+				delete(l.last, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	if at, ok := l.last[chatID]; ok && now.Sub(at) < l.interval {
+		return false
+	}
+	l.last[chatID] = now
+	return true
+}
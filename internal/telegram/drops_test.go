@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDropCounterAggregatesLogs(t *testing.T) {
+	counter := newDropCounter(time.Minute)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	counter.now = func() time.Time { return now }
+
+	// Первый отброс виден в логе сразу.
+	if count, ok := counter.add(); !ok || count != 1 {
+		t.Fatalf("expected first drop to be logged, got %d %v", count, ok)
+	}
+	for i := 0; i < 3; i++ {
+		now = now.Add(10 * time.Second)
+		if _, ok := counter.add(); ok {
+			t.Fatalf("drop %d within interval must not be logged", i)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	count, ok := counter.add()
+	if !ok || count != 4 {
+		t.Fatalf("expected summary of 4 drops after interval, got %d %v", count, ok)
+	}
+	if counter.Total() != 5 {
+		t.Fatalf("expected total of 5 drops, got %d", counter.Total())
+	}
+
+	// Серия закончилась: два отброса после сводки попадают в лог при первом
+	// успешном захвате воркера, но не раньше интервала.
+	for i := 0; i < 2; i++ {
+		now = now.Add(10 * time.Second)
+		if _, ok := counter.add(); ok {
+			t.Fatalf("drop %d within interval must not be logged", i)
+		}
+	}
+	if _, ok := counter.flush(); ok {
+		t.Fatal("flush within interval must not log")
+	}
+	now = now.Add(time.Minute)
+	if count, ok := counter.flush(); !ok || count != 2 {
+		t.Fatalf("expected tail of 2 drops to be flushed, got %d %v", count, ok)
+	}
+	if _, ok := counter.flush(); ok {
+		t.Fatal("expected nothing left to flush")
+	}
+}
+
+func TestNoticeLimiterOncePerChatPerInterval(t *testing.T) {
+	limiter := newNoticeLimiter(time.Minute)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.allow(1) {
+		t.Fatal("expected first notice to be allowed")
+	}
+	now = now.Add(10 * time.Second)
+	if limiter.allow(1) {
+		t.Fatal("expected repeated notice within interval to be suppressed")
+	}
+	if !limiter.allow(2) {
+		t.Fatal("expected notice to another chat to be allowed")
+	}
+
+	now = now.Add(time.Minute)
+	if !limiter.allow(1) {
+		t.Fatal("expected notice to be allowed after interval")
+	}
+	if _, ok := limiter.last[2]; ok {
+		t.Fatal("expected stale chat to be forgotten")
+	}
+}
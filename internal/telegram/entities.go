@@ -0,0 +1,96 @@
+package telegram
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// entityText возвращает фрагмент текста, размеченный сущностью.
+// Смещения в Bot API заданы в UTF-16, поэтому текст перекодируется.
+func entityText(text string, e MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+}
+
+// removeEntity вырезает размеченный фрагмент из текста.
+func removeEntity(text string, e MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > len(units) {
+		return text
+	}
+	rest := append(append([]uint16{}, units[:e.Offset]...), units[e.Offset+e.Length:]...)
+	return string(utf16.Decode(rest))
+}
+
+// renderEntities восстанавливает разметку сообщения в markdown-подобном виде, чтобы
+// модель видела ссылки за текстом и границы кода. Вложенные сущности не поддерживаются:
+// сущность, пересекающаяся с предыдущей, остается простым текстом.
+func renderEntities(text string, entities []MessageEntity) string {
+	if len(entities) == 0 {
+		return text
+	}
+	sorted := append([]MessageEntity(nil), entities...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	units := utf16.Encode([]rune(text))
+	var b strings.Builder
+	pos := 0
+	for _, e := range sorted {
+		if e.Offset < pos || e.Length <= 0 || e.Offset+e.Length > len(units) {
+			continue
+		}
+		part := string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+		rendered, ok := renderEntity(part, e)
+		if !ok {
+			continue
+		}
+		b.WriteString(string(utf16.Decode(units[pos:e.Offset])))
+		b.WriteString(rendered)
+		pos = e.Offset + e.Length
+	}
+	b.WriteString(string(utf16.Decode(units[pos:])))
+	return b.String()
+}
+
+// renderEntity оформляет один фрагмент; ok == false для сущностей, которые
+// не влияют на смысл текста (упоминания, хештеги, обычные ссылки).
+func renderEntity(part string, e MessageEntity) (string, bool) {
+	switch e.Type {
+	case "text_link":
+		if e.URL == "" {
+			return "", false
+		}
+		return "[" + part + "](" + e.URL + ")", true
+	case "code":
+		return "`" + part + "`", true
+	case "pre":
+		return "```" + e.Language + "\n" + part + "\n```", true
+	case "bold":
+		return "**" + part + "**", true
+	case "italic":
+		return "_" + part + "_", true
+	default:
+		return "", false
+	}
+}
+
+// stripMention ищет упоминание @username в сообщении и возвращает текст без него.
+// ok == false, если бот в сообщении не упомянут.
+func stripMention(msg *Message, username string) (string, bool) {
+	if username == "" {
+		return msg.Text, false
+	}
+	for _, e := range msg.Entities {
+		if e.Type != "mention" {
+			continue
+		}
+		if strings.EqualFold(entityText(msg.Text, e), "@"+username) {
+			return strings.TrimSpace(removeEntity(msg.Text, e)), true
+		}
+	}
+	return msg.Text, false
+}
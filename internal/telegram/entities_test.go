@@ -0,0 +1,157 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"aiadvent/internal/auth"
+)
+
+func TestDecodeMessageEntities(t *testing.T) {
+	payload := `{"update_id":1,"message":{"message_id":3,"text":"см. документацию","chat":{"id":1},"from":{"id":1},
+		"entities":[{"type":"text_link","offset":4,"length":12,"url":"https://go.dev/doc"},{"type":"pre","offset":0,"length":3,"language":"go"}]}}`
+
+	var upd Update
+	if err := json.Unmarshal([]byte(payload), &upd); err != nil {
+		t.Fatalf("decode update: %v", err)
+	}
+	entities := upd.Message.Entities
+	if len(entities) != 2 {
+		t.Fatalf("expected 2 entities, got %+v", entities)
+	}
+	if entities[0].Type != "text_link" || entities[0].URL != "https://go.dev/doc" {
+		t.Fatalf("unexpected link entity: %+v", entities[0])
+	}
+	if entities[1].Language != "go" {
+		t.Fatalf("unexpected pre entity: %+v", entities[1])
+	}
+}
+
+func TestRenderEntities(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		entities []MessageEntity
+		want     string
+	}{
+		{
+			name:     "no entities",
+			text:     "просто текст",
+			entities: nil,
+			want:     "просто текст",
+		},
+		{
+			name:     "text link",
+			text:     "почитай статью 👉 тут",
+			entities: []MessageEntity{{Type: "text_link", Offset: 18, Length: 3, URL: "https://example.com"}},
+			want:     "почитай статью 👉 [тут](https://example.com)",
+		},
+		{
+			name: "code and bold",
+			text: "почему fmt.Println падает? срочно",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 27, Length: 6},
+				{Type: "code", Offset: 7, Length: 11},
+			},
+			want: "почему `fmt.Println` падает? **срочно**",
+		},
+		{
+			name:     "pre with language",
+			text:     "что не так:\nx := 1",
+			entities: []MessageEntity{{Type: "pre", Offset: 12, Length: 6, Language: "go"}},
+			want:     "что не так:\n```go\nx := 1\n```",
+		},
+		{
+			name: "mention and nested entities stay plain",
+			text: "@user смотри ссылку",
+			entities: []MessageEntity{
+				{Type: "mention", Offset: 0, Length: 5},
+				{Type: "text_link", Offset: 13, Length: 6, URL: "https://example.com"},
+				{Type: "bold", Offset: 14, Length: 2},
+			},
+			want: "@user смотри [ссылку](https://example.com)",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := renderEntities(tc.text, tc.entities); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAskSendsLinksToModel(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	model := &recordingLLM{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   authService,
+		LLM:    model,
+		Bot:    bot,
+		Logger: logger,
+	})
+	if _, err := authService.Login(context.Background(), 1, "pass"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	sendUpdate(t, handler, 1, "/ask")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendMessage(t, handler, &Message{
+		Text:     "что в этой статье?",
+		Chat:     Chat{ID: 1},
+		From:     &User{ID: 1},
+		Entities: []MessageEntity{{Type: "text_link", Offset: 6, Length: 4, URL: "https://go.dev/blog"}},
+	})
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+
+	calls := model.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected one LLM call, got %d", len(calls))
+	}
+	last := calls[0][len(calls[0])-1]
+	if last.Content != "что в [этой](https://go.dev/blog) статье?" {
+		t.Fatalf("expected link to be passed to the model, got %q", last.Content)
+	}
+}
+
+func TestAskCommandArgumentKeepsLinks(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	model := &recordingLLM{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   authService,
+		LLM:    model,
+		Bot:    bot,
+		Logger: logger,
+	})
+	if _, err := authService.Login(context.Background(), 1, "pass"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	sendMessage(t, handler, &Message{
+		Text: "/ask что в этой статье?",
+		Chat: Chat{ID: 1},
+		From: &User{ID: 1},
+		Entities: []MessageEntity{
+			{Type: "bot_command", Offset: 0, Length: 4},
+			{Type: "text_link", Offset: 11, Length: 4, URL: "https://go.dev/blog"},
+		},
+	})
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+
+	calls := model.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected one LLM call, got %d", len(calls))
+	}
+	last := calls[0][len(calls[0])-1]
+	if last.Content != "что в [этой](https://go.dev/blog) статье?" {
+		t.Fatalf("expected link to be passed to the model, got %q", last.Content)
+	}
+}
@@ -0,0 +1,179 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	langRU      = "ru"
+	langEN      = "en"
+	defaultLang = langRU
+)
+
+// Ключи каталога строк интерфейса бота.
+const (
+	msgStart             = "start"
+	msgEnterPassword     = "enter_password"
+	msgLoginPrivateOnly  = "login_private_only"
+	msgLoggedOut         = "logged_out"
+	msgMe                = "me"
+	msgStatusAuthorized  = "status_authorized"
+	msgStatusAnonymous   = "status_anonymous"
+	msgWhoami            = "whoami"
+	msgSessionForever    = "session_forever"
+	msgSessionUntil      = "session_until"
+	msgModeDefault       = "mode_default"
+	msgModeAsk           = "mode_ask"
+	msgModeAskMemory     = "mode_ask_memory"
+	msgAuthRequired      = "auth_required"
+	msgAskModeMemory     = "ask_mode_memory"
+	msgAskMode           = "ask_mode"
+	msgAskModeOff        = "ask_mode_off"
+	msgNotInAskMode      = "not_in_ask_mode"
+	msgUnknownCommand    = "unknown_command"
+	msgLoginRequired     = "login_required"
+	msgAskHint           = "ask_hint"
+	msgTooManyAttempts   = "too_many_attempts"
+	msgAuthError         = "auth_error"
+	msgLoggedIn          = "logged_in"
+	msgAdminOnly         = "admin_only"
+	msgBroadcastUsage    = "broadcast_usage"
+	msgBroadcastListFail = "broadcast_list_failed"
+	msgBroadcastDone     = "broadcast_done"
+	msgStats             = "stats"
+	msgStatsFailed       = "stats_failed"
+	msgEmptyQuestion     = "empty_question"
+	msgThinking          = "thinking"
+	msgLLMError          = "llm_error"
+	msgLLMEmpty          = "llm_empty"
+	msgFallbackModel     = "fallback_model"
+	msgBusy              = "busy"
+	msgEditUnsupported   = "edit_unsupported"
+	msgAccessDenied      = "access_denied"
+	msgEmptyMessage      = "empty_message"
+	msgUnknownState      = "unknown_state"
+	msgLangUsage         = "lang_usage"
+	msgLangChanged       = "lang_changed"
+)
+
+// catalog тексты по языкам. Ключ, которого нет в выбранном языке, берется из русского.
+var catalog = map[string]map[string]string{
+	langRU: {
+		msgStart:             "Привет! Команды: /login, /ask (включает режим вопросов, выход /end), /logout, /me, /lang. Введите команду, параметр — отдельным сообщением.",
+		msgEnterPassword:     "Введите пароль следующим сообщением",
+		msgLoginPrivateOnly:  "Войдите в личном чате с ботом: пароль в группе увидят все участники",
+		msgLoggedOut:         "Вы вышли",
+		msgMe:                "Ваш id: %d, статус: %s",
+		msgStatusAuthorized:  "авторизован",
+		msgStatusAnonymous:   "не авторизован",
+		msgWhoami:            "ID: %d\nUsername: %s\nСтатус: %s\nСессия: %s\nРежим: %s",
+		msgSessionForever:    "бессрочная",
+		msgSessionUntil:      "до %s",
+		msgModeDefault:       "обычный",
+		msgModeAsk:           "вопросы (/ask)",
+		msgModeAskMemory:     "вопросы с памятью (/ask)",
+		msgAuthRequired:      "Требуется авторизация. Отправьте /login, затем пароль отдельным сообщением.",
+		msgAskModeMemory:     "Режим вопросов включен. Я помню предыдущие вопросы до команды /end.",
+		msgAskMode:           "Режим вопросов включен. Отправляйте сообщения — я буду отвечать. Команда /end выключит режим.",
+		msgAskModeOff:        "Режим вопросов выключен.",
+		msgNotInAskMode:      "Вы не в режиме вопросов. Отправьте /ask, чтобы начать.",
+		msgUnknownCommand:    "Неизвестная команда. Попробуйте /start",
+		msgLoginRequired:     "Нужно войти: отправьте /login и затем пароль отдельным сообщением",
+		msgAskHint:           "Чтобы задать вопрос, включите режим /ask. Команда /end выключает режим.",
+		msgTooManyAttempts:   "Слишком много попыток, попробуйте позже",
+		msgAuthError:         "Ошибка авторизации",
+		msgLoggedIn:          "Вы успешно вошли",
+		msgAdminOnly:         "Команда доступна только администратору",
+		msgBroadcastUsage:    "Использование: /broadcast <текст>",
+		msgBroadcastListFail: "Не удалось получить список пользователей",
+		msgBroadcastDone:     "Рассылка отправлена: %d из %d",
+		msgStats:             "Сессий: %d\nДиалогов: %d\nВоркеры: %d из %d\nОтброшено update: %d\nАптайм: %s",
+		msgStatsFailed:       "Не удалось собрать статистику",
+		msgEmptyQuestion:     "Нужно задать вопрос. Отправьте текст следующим сообщением",
+		msgThinking:          "Думаю...",
+		msgLLMError:          "Ошибка LLM. Попробуйте позже.",
+		msgLLMEmpty:          "Модель вернула пустой ответ, попробуйте переформулировать",
+		msgFallbackModel:     "(ответ резервной модели %s)",
+		msgBusy:              "Сервис занят, попробуйте через минуту",
+		msgEditUnsupported:   "Редактирование сообщений не поддерживается. Отправьте новое сообщение.",
+		msgAccessDenied:      "Доступ запрещён",
+		msgEmptyMessage:      "Пустое сообщение. Используйте /start.",
+		msgUnknownState:      "Неизвестное состояние. Попробуйте снова отправить команду.",
+		msgLangUsage:         "Использование: /lang ru|en",
+		msgLangChanged:       "Язык интерфейса: русский",
+	},
+	langEN: {
+		msgStart:             "Hi! Commands: /login, /ask (enables question mode, exit with /end), /logout, /me, /lang. Send the command, then its parameter as a separate message.",
+		msgEnterPassword:     "Send the password in the next message",
+		msgLoginPrivateOnly:  "Please log in in a private chat with the bot: everyone in the group would see the password",
+		msgLoggedOut:         "You are logged out",
+		msgMe:                "Your id: %d, status: %s",
+		msgStatusAuthorized:  "authorized",
+		msgStatusAnonymous:   "not authorized",
+		msgWhoami:            "ID: %d\nUsername: %s\nStatus: %s\nSession: %s\nMode: %s",
+		msgSessionForever:    "no expiry",
+		msgSessionUntil:      "until %s",
+		msgModeDefault:       "default",
+		msgModeAsk:           "questions (/ask)",
+		msgModeAskMemory:     "questions with memory (/ask)",
+		msgAuthRequired:      "Authorization required. Send /login, then the password as a separate message.",
+		msgAskModeMemory:     "Question mode is on. I remember previous questions until /end.",
+		msgAskMode:           "Question mode is on. Send messages and I will answer. /end turns the mode off.",
+		msgAskModeOff:        "Question mode is off.",
+		msgNotInAskMode:      "You are not in question mode. Send /ask to start.",
+		msgUnknownCommand:    "Unknown command. Try /start",
+		msgLoginRequired:     "Please log in: send /login and then the password as a separate message",
+		msgAskHint:           "To ask a question, enable /ask mode. /end turns the mode off.",
+		msgTooManyAttempts:   "Too many attempts, try again later",
+		msgAuthError:         "Authorization failed",
+		msgLoggedIn:          "You are logged in",
+		msgAdminOnly:         "This command is available to administrators only",
+		msgBroadcastUsage:    "Usage: /broadcast <text>",
+		msgBroadcastListFail: "Failed to get the user list",
+		msgBroadcastDone:     "Broadcast sent: %d of %d",
+		msgStats:             "Sessions: %d\nDialogs: %d\nWorkers: %d of %d\nDropped updates: %d\nUptime: %s",
+		msgStatsFailed:       "Failed to collect statistics",
+		msgEmptyQuestion:     "Please ask a question. Send the text in the next message",
+		msgThinking:          "Thinking...",
+		msgLLMError:          "LLM error. Try again later.",
+		msgLLMEmpty:          "The model returned an empty answer, try rephrasing",
+		msgFallbackModel:     "(answer from fallback model %s)",
+		msgBusy:              "The service is busy, please try again in a minute",
+		msgEditUnsupported:   "Editing messages is not supported. Send a new message.",
+		msgAccessDenied:      "Access denied",
+		msgEmptyMessage:      "Empty message. Use /start.",
+		msgUnknownState:      "Unknown state. Try sending the command again.",
+		msgLangUsage:         "Usage: /lang ru|en",
+		msgLangChanged:       "Interface language: English",
+	},
+}
+
+// translate возвращает текст ключа на языке lang с подстановкой args.
+// Неизвестный язык или отсутствующий перевод заменяются русским текстом.
+func translate(lang, key string, args ...any) string {
+	text, ok := catalog[lang][key]
+	if !ok {
+		text, ok = catalog[defaultLang][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// normalizeLang приводит language_code Telegram ("en-US", "ru") к языку каталога.
+// Пустая строка означает, что такого языка в каталоге нет.
+func normalizeLang(code string) string {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if _, ok := catalog[code]; ok {
+		return code
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package telegram
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"aiadvent/internal/auth"
+	"aiadvent/internal/llm"
+)
+
+func TestTranslateFallsBackToRussian(t *testing.T) {
+	if got := translate(langEN, msgLoggedOut); got != "You are logged out" {
+		t.Fatalf("unexpected english text: %q", got)
+	}
+	if got := translate(langRU, msgLoggedOut); got != "Вы вышли" {
+		t.Fatalf("unexpected russian text: %q", got)
+	}
+	if got := translate("de", msgLoggedOut); got != "Вы вышли" {
+		t.Fatalf("expected fallback to russian for unknown language, got %q", got)
+	}
+	if got := translate(langEN, msgMe, int64(7), "authorized"); got != "Your id: 7, status: authorized" {
+		t.Fatalf("unexpected formatted text: %q", got)
+	}
+}
+
+func TestCatalogLanguagesHaveSameKeys(t *testing.T) {
+	for key := range catalog[defaultLang] {
+		if _, ok := catalog[langEN][key]; !ok {
+			t.Errorf("english translation is missing for %q", key)
+		}
+	}
+}
+
+func TestNormalizeLang(t *testing.T) {
+	cases := map[string]string{"en": langEN, "en-US": langEN, "RU": langRU, "de": "", "": ""}
+	for code, want := range cases {
+		if got := normalizeLang(code); got != want {
+			t.Errorf("normalizeLang(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestLanguageFromTelegramAndLangCommand(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "ok"},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	send := func(text string) {
+		sendMessage(t, handler, &Message{Text: text, Chat: Chat{ID: 1}, From: &User{ID: 1, LanguageCode: "en-GB"}})
+	}
+
+	send("/logout")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	if got := bot.Messages()[0]; got != "You are logged out" {
+		t.Fatalf("expected english from language_code, got %q", got)
+	}
+
+	send("/lang ru")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	send("/logout")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+	if got := bot.Messages()[2]; got != "Вы вышли" {
+		t.Fatalf("expected /lang choice to override language_code, got %q", got)
+	}
+}
+
+func TestDecodeUserLanguageCode(t *testing.T) {
+	payload := `{"update_id":1,"message":{"message_id":2,"text":"hi","chat":{"id":3,"type":"private"},"from":{"id":3,"username":"u","language_code":"de"}}}`
+
+	var upd Update
+	if err := json.Unmarshal([]byte(payload), &upd); err != nil {
+		t.Fatalf("decode update: %v", err)
+	}
+	if got := upd.Message.From.LanguageCode; got != "de" {
+		t.Fatalf("unexpected language code: %q", got)
+	}
+}
+
+func TestAskAddsLanguageHint(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	model := &recordingLLM{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:          auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:           model,
+		Bot:           bot,
+		Logger:        logger,
+		LanguageHints: true,
+	})
+
+	from := &User{ID: 1, LanguageCode: "de"}
+	sendMessage(t, handler, &Message{Text: "/login pass", Chat: Chat{ID: 1}, From: from})
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendMessage(t, handler, &Message{Text: "/ask Wie spät ist es?", Chat: Chat{ID: 1}, From: from})
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+
+	calls := model.Calls()
+	if len(calls) != 1 || len(calls[0]) != 2 {
+		t.Fatalf("expected system hint and question, got %v", calls)
+	}
+	if calls[0][0].Role != llm.RoleSystem || !strings.Contains(calls[0][0].Content, "de") {
+		t.Fatalf("unexpected language hint: %+v", calls[0][0])
+	}
+	if calls[0][1].Content != "Wie spät ist es?" {
+		t.Fatalf("unexpected question: %+v", calls[0][1])
+	}
+}
@@ -0,0 +1,83 @@
+package telegram
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	mdHeading = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	mdBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	mdRule    = regexp.MustCompile(`^\s{0,3}([-*_])(\s*[-*_]){2,}\s*$`)
+	mdLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold    = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	mdStrike  = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	mdStarEm  = regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	mdUnderEm = regexp.MustCompile(`(^|[^\w])_([^_\s](?:[^_]*[^_\s])?)_($|[^\w])`)
+)
+
+const mdCodeFence = "```"
+
+// markdownEscaper экранирует служебные символы parse_mode Markdown во вставляемом тексте.
+var markdownEscaper = strings.NewReplacer("_", `\_`, "*", `\*`, "`", "\\`", "[", `\[`)
+
+// RenderPlain превращает markdown из ответа модели в читаемый простой текст для случая,
+// когда Telegram отклонил разметку: иначе пользователь увидит звездочки и решетки.
+// Код внутри ``` и `...` сохраняется как есть, без снятия разметки; заголовки
+// теряют #, маркеры списков заменяются на •, ссылки выводятся как «текст (url)».
+func RenderPlain(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	out := make([]string, 0, len(lines))
+	inCode := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), mdCodeFence) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+		out = append(out, renderPlainLine(line))
+	}
+	return strings.Join(out, "\n")
+}
+
+func renderPlainLine(line string) string {
+	if mdRule.MatchString(line) {
+		return ""
+	}
+	if m := mdHeading.FindStringSubmatch(line); m != nil {
+		line = m[1]
+	}
+	line = mdBullet.ReplaceAllString(line, "$1• ")
+	line = strings.TrimPrefix(line, "> ")
+
+	// Нечетные части между обратными кавычками — инлайн-код, его не трогаем.
+	parts := strings.Split(line, "`")
+	if len(parts)%2 == 0 {
+		// Непарная кавычка: считаем ее обычным символом.
+		last := len(parts) - 1
+		parts[last-1] += "`" + parts[last]
+		parts = parts[:last]
+	}
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = renderPlainInline(parts[i])
+	}
+	return strings.Join(parts, "")
+}
+
+func renderPlainInline(s string) string {
+	s = mdLink.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdLink.FindStringSubmatch(m)
+		if sub[1] == sub[2] {
+			return sub[2]
+		}
+		return sub[1] + " (" + sub[2] + ")"
+	})
+	s = mdBold.ReplaceAllString(s, "$1$2")
+	s = mdStrike.ReplaceAllString(s, "$1")
+	s = mdStarEm.ReplaceAllString(s, "$1$2")
+	s = mdUnderEm.ReplaceAllString(s, "$1$2$3")
+	return s
+}
@@ -0,0 +1,32 @@
+package telegram
+
+import "testing"
+
+func TestRenderPlain(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain text", in: "Просто ответ.", want: "Просто ответ."},
+		{name: "bold and italic", in: "Это **важно** и *очень* __нужно__, _правда_.", want: "Это важно и очень нужно, правда."},
+		{name: "strikethrough", in: "~~старое~~ новое", want: "старое новое"},
+		{name: "snake case kept", in: "переменная max_retry_count и 2*3*4", want: "переменная max_retry_count и 2*3*4"},
+		{name: "heading", in: "## Итоги ##\nтекст", want: "Итоги\nтекст"},
+		{name: "bullets", in: "- первый\n* второй\n  + вложенный", want: "• первый\n• второй\n  • вложенный"},
+		{name: "numbered list kept", in: "1. **шаг** один\n2. шаг два", want: "1. шаг один\n2. шаг два"},
+		{name: "link", in: "см. [документацию](https://go.dev/doc)", want: "см. документацию (https://go.dev/doc)"},
+		{name: "bare link", in: "[https://go.dev](https://go.dev)", want: "https://go.dev"},
+		{name: "inline code", in: "вызовите `**kwargs` и *готово*", want: "вызовите **kwargs и готово"},
+		{name: "unpaired backtick", in: "кавычка ` и **жирный**", want: "кавычка ` и жирный"},
+		{name: "code block", in: "Пример:\n```go\nx := a * b // **не** разметка\n```\nГотово", want: "Пример:\nx := a * b // **не** разметка\nГотово"},
+		{name: "rule and quote", in: "> цитата\n---\nконец", want: "цитата\n\nконец"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := RenderPlain(tc.in); got != tc.want {
+				t.Fatalf("RenderPlain(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package telegram
+
+import "sync"
+
+// maxUserQueue сколько обновлений одного пользователя может быть в работе одновременно:
+// одно обрабатывается, остальные ждут своей очереди. Лишние отбрасываются, чтобы
+// поток сообщений от одного пользователя не копил горутины.
+const maxUserQueue = 3
+
+// userSerializer выстраивает обработку обновлений одного пользователя в очередь
+// в порядке поступления, не ограничивая параллелизм между разными пользователями.
+// Без этого "/ask" и следующий сразу за ним вопрос могли обработаться в обратном порядке.
+type userSerializer struct {
+	mu     sync.Mutex
+	limit  int
+	queues map[int64]*userQueue
+}
+
+type userQueue struct {
+	tail chan struct{}
+	size int
+}
+
+func newUserSerializer(limit int) *userSerializer {
+	return &userSerializer{limit: limit, queues: make(map[int64]*userQueue)}
+}
+
+// enqueue ставит обновление в очередь пользователя. Возвращает канал, закрытие
+// которого означает завершение предыдущего обновления (nil — очередь пуста),
+// и канал текущего, который нужно передать в done. ok == false, если очередь
+// пользователя заполнена и обновление нужно отбросить.
+func (s *userSerializer) enqueue(userID int64) (prev, own chan struct{}, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.queues[userID]
+	if q == nil {
+		q = &userQueue{}
+		s.queues[userID] = q
+	}
+	if s.limit > 0 && q.size >= s.limit {
+		return nil, nil, false
+	}
+	prev = q.tail
+	own = make(chan struct{})
+	q.tail = own
+	q.size++
+	return prev, own, true
+}
+
+// done отмечает обновление обработанным и пропускает следующее в очереди.
+func (s *userSerializer) done(userID int64, own chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(own)
+	q := s.queues[userID]
+	q.size--
+	if q.size == 0 {
+		delete(s.queues, userID)
+	}
+}
@@ -1,21 +1,57 @@
 package telegram
 
 type Update struct {
-	Message *Message `json:"message"`
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+	// EditedMessage приходит, когда пользователь редактирует ранее отправленное сообщение.
+	EditedMessage *Message `json:"edited_message"`
 }
 
 type Message struct {
-	MessageID int64  `json:"message_id"`
-	Text      string `json:"text"`
-	Chat      Chat   `json:"chat"`
-	From      *User  `json:"from"`
+	MessageID int64           `json:"message_id"`
+	Text      string          `json:"text"`
+	Chat      Chat            `json:"chat"`
+	From      *User           `json:"from"`
+	Entities  []MessageEntity `json:"entities"`
+}
+
+// MessageEntity размечает часть текста (упоминание, команду и т.п.).
+// Offset и Length считаются в UTF-16 code units, как в Bot API.
+type MessageEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	// URL адрес для text_link: ссылка, спрятанная за текстом.
+	URL string `json:"url,omitempty"`
+	// Language язык блока кода для pre.
+	Language string `json:"language,omitempty"`
 }
 
 type Chat struct {
-	ID int64 `json:"id"`
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+// IsGroup сообщает, что сообщение пришло из группы или супергруппы.
+func (c Chat) IsGroup() bool {
+	return c.Type == "group" || c.Type == "supergroup"
 }
 
 type User struct {
 	ID       int64  `json:"id"`
 	Username string `json:"username"`
+	// LanguageCode IETF-тег языка клиента пользователя, например "en" или "ru".
+	LanguageCode string `json:"language_code"`
+}
+
+// WebhookInfo состояние вебхука из getWebhookInfo.
+type WebhookInfo struct {
+	URL                          string `json:"url"`
+	HasCustomCertificate         bool   `json:"has_custom_certificate"`
+	PendingUpdateCount           int    `json:"pending_update_count"`
+	LastErrorDate                int64  `json:"last_error_date"`
+	LastErrorMessage             string `json:"last_error_message"`
+	LastSynchronizationErrorDate int64  `json:"last_synchronization_error_date"`
+	MaxConnections               int    `json:"max_connections"`
+	IPAddress                    string `json:"ip_address"`
 }
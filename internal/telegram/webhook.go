@@ -2,8 +2,11 @@ package telegram
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"strings"
 	"sync"
@@ -12,13 +15,23 @@ import (
 	"aiadvent/internal/auth"
 	"aiadvent/internal/httpserver"
 	"aiadvent/internal/llm"
+	"aiadvent/internal/requestid"
 	"log/slog"
 )
 
 const (
+	secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
 	defaultProcessingTimeout = 60 * time.Second
 	defaultAcquireTimeout    = 200 * time.Millisecond
 	defaultMaxWorkers        = 10
+	// defaultBroadcastDelay пауза между сообщениями рассылки: Telegram ограничивает
+	// бота примерно 30 сообщениями в секунду.
+	defaultBroadcastDelay = 50 * time.Millisecond
+	// defaultMaxBodyBytes лимит тела вебхука: обновления Telegram весят единицы килобайт.
+	defaultMaxBodyBytes = 256 << 10
+	// busyNoticeTimeout лимит на отправку сообщения о перегрузке.
+	busyNoticeTimeout = 5 * time.Second
 )
 
 type pendingCommand string
@@ -28,14 +41,21 @@ const (
 )
 
 type userState struct {
-	pending pendingCommand
-	askMode bool
+	pending  pendingCommand
+	askMode  bool
+	dialogID string
+	// lang язык интерфейса, выбранный через /lang; пустой — по language_code из Telegram.
+	lang string
 }
 
 type AuthService interface {
 	Login(ctx context.Context, userID int64, password string) (auth.Session, error)
 	Logout(ctx context.Context, userID int64)
 	IsAuthorized(ctx context.Context, userID int64) bool
+	IsAuthorizedRole(ctx context.Context, userID int64, role auth.Role) bool
+	AuthorizedUserIDs(ctx context.Context) ([]int64, error)
+	// Session возвращает действующую сессию, не продлевая ее.
+	Session(ctx context.Context, userID int64) (auth.Session, bool)
 }
 
 type WebhookDeps struct {
@@ -46,6 +66,25 @@ type WebhookDeps struct {
 	AdminPassword string
 	SessionTTL    time.Duration
 	WebhookSecret string
+	// Dialogs хранит историю /ask, когда включен AskMemory.
+	Dialogs *llm.DialogService
+	// AskMemory включает режим /ask с памятью контекста; по умолчанию вопросы независимы.
+	AskMemory bool
+	// AllowedChatIDs ограничивает работу бота этими чатами; пустой список — без ограничений.
+	AllowedChatIDs []int64
+	// LanguageHints добавляет к вопросам /ask системную инструкцию отвечать на языке пользователя.
+	LanguageHints bool
+	// MaxBodyBytes лимит размера тела запроса вебхука; 0 — значение по умолчанию.
+	MaxBodyBytes int64
+	// BroadcastDelay пауза между сообщениями /broadcast; 0 — значение по умолчанию.
+	BroadcastDelay time.Duration
+	// DedupWindow сколько помнить update_id для отбрасывания повторных доставок; 0 — не проверять.
+	DedupWindow time.Duration
+	// AuditSink получает записи аудита команд в дополнение к логу; может быть nil.
+	AuditSink AuditSink
+	// BotUsername имя бота без @ для распознавания упоминаний в группах.
+	// Если не задано, запрашивается через getMe при первом сообщении из группы.
+	BotUsername string
 	// Необязательные настройки параллельной обработки.
 	ProcessingTimeout time.Duration
 	AcquireTimeout    time.Duration
@@ -53,17 +92,31 @@ type WebhookDeps struct {
 }
 
 type WebhookHandler struct {
-	auth          AuthService
-	llm           llm.Client
-	bot           BotClient
-	logger        *slog.Logger
-	adminPassword string
-	webhookSecret string
-	sem           chan struct{}
-	processingTTL time.Duration
-	acquireTTL    time.Duration
-	stateMu       sync.Mutex
-	state         map[int64]userState
+	auth           AuthService
+	llm            llm.Client
+	bot            BotClient
+	logger         *slog.Logger
+	adminPassword  string
+	webhookSecret  string
+	dialogs        *llm.DialogService
+	askMemory      bool
+	allowedChats   map[int64]struct{}
+	dedup          *updateDeduper
+	broadcastDelay time.Duration
+	languageHints  bool
+	maxBodyBytes   int64
+	auditSink      AuditSink
+	startedAt      time.Time
+	usernameMu     sync.Mutex
+	botUsername    string
+	sem            chan struct{}
+	processingTTL  time.Duration
+	acquireTTL     time.Duration
+	serial         *userSerializer
+	drops          *dropCounter
+	busyNotices    *noticeLimiter
+	stateMu        sync.Mutex
+	state          map[int64]userState
 }
 
 func NewWebhookHandler(deps WebhookDeps) *WebhookHandler {
@@ -80,46 +133,130 @@ func NewWebhookHandler(deps WebhookDeps) *WebhookHandler {
 		acquireTTL = defaultAcquireTimeout
 	}
 
+	var allowedChats map[int64]struct{}
+	if len(deps.AllowedChatIDs) > 0 {
+		allowedChats = make(map[int64]struct{}, len(deps.AllowedChatIDs))
+		for _, id := range deps.AllowedChatIDs {
+			allowedChats[id] = struct{}{}
+		}
+	}
+
+	maxBodyBytes := deps.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+	broadcastDelay := deps.BroadcastDelay
+	if broadcastDelay <= 0 {
+		broadcastDelay = defaultBroadcastDelay
+	}
+
+	var dedup *updateDeduper
+	if deps.DedupWindow > 0 {
+		dedup = newUpdateDeduper(deps.DedupWindow)
+	}
+
 	return &WebhookHandler{
-		auth:          deps.Auth,
-		llm:           deps.LLM,
-		bot:           deps.Bot,
-		logger:        deps.Logger,
-		adminPassword: deps.AdminPassword,
-		webhookSecret: deps.WebhookSecret,
-		sem:           make(chan struct{}, maxWorkers),
-		processingTTL: processingTTL,
-		acquireTTL:    acquireTTL,
-		state:         make(map[int64]userState),
+		auth:           deps.Auth,
+		llm:            deps.LLM,
+		bot:            deps.Bot,
+		logger:         deps.Logger,
+		adminPassword:  deps.AdminPassword,
+		webhookSecret:  deps.WebhookSecret,
+		dialogs:        deps.Dialogs,
+		askMemory:      deps.AskMemory && deps.Dialogs != nil,
+		allowedChats:   allowedChats,
+		dedup:          dedup,
+		broadcastDelay: broadcastDelay,
+		languageHints:  deps.LanguageHints,
+		maxBodyBytes:   maxBodyBytes,
+		auditSink:      deps.AuditSink,
+		startedAt:      time.Now(),
+		serial:         newUserSerializer(maxUserQueue),
+		drops:          newDropCounter(dropLogInterval),
+		busyNotices:    newNoticeLimiter(dropLogInterval),
+		botUsername:    strings.TrimPrefix(deps.BotUsername, "@"),
+		sem:            make(chan struct{}, maxWorkers),
+		processingTTL:  processingTTL,
+		acquireTTL:     acquireTTL,
+		state:          make(map[int64]userState),
 	}
 }
 
+// jsonContentType допускает application/json с любыми параметрами. Пустой заголовок
+// тоже разрешен: тело все равно разбирается как JSON.
+func jsonContentType(value string) bool {
+	if value == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(value)
+	return err == nil && mediaType == "application/json"
+}
+
+// validSecret сравнивает секрет за постоянное время, чтобы не раскрывать его префикс по таймингу.
+// Отсутствующий заголовок при настроенном секрете всегда отклоняется.
+func (h *WebhookHandler) validSecret(secret string) bool {
+	if secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(h.webhookSecret)) == 1
+}
+
 func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h.webhookSecret != "" {
-		if secret := r.Header.Get("X-Telegram-Bot-Api-Secret-Token"); secret != h.webhookSecret {
-			httpserver.WriteJSONError(w, http.StatusForbidden, "forbidden", "invalid webhook secret")
-			return
-		}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpserver.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only POST is allowed")
+		return
+	}
+	if !jsonContentType(r.Header.Get("Content-Type")) {
+		httpserver.WriteJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "content type must be application/json")
+		return
+	}
+	if h.webhookSecret != "" && !h.validSecret(r.Header.Get(secretHeader)) {
+		httpserver.WriteJSONError(w, http.StatusForbidden, "forbidden", "invalid webhook secret")
+		return
 	}
 
 	var upd Update
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
 	if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpserver.WriteJSONError(w, http.StatusRequestEntityTooLarge, "payload_too_large", "update body is too large")
+			return
+		}
 		httpserver.WriteJSONError(w, http.StatusBadRequest, "bad_request", "cannot parse update")
 		return
 	}
-	if upd.Message == nil || upd.Message.From == nil {
+	msg, edited := upd.Message, false
+	if msg == nil && upd.EditedMessage != nil {
+		msg, edited = upd.EditedMessage, true
+	}
+	if msg == nil || msg.From == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reqID := requestid.FromContext(r.Context())
+	if reqID == "" {
+		reqID = r.Header.Get(requestid.Header)
+	}
+
+	if h.dedup != nil && upd.UpdateID != 0 && h.dedup.Seen(upd.UpdateID) {
+		h.logger.Info("duplicate telegram update skipped",
+			slog.Int64("update_id", upd.UpdateID),
+			slog.String("request_id", reqID))
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	text := strings.TrimSpace(upd.Message.Text)
+	text := strings.TrimSpace(msg.Text)
 
 	// Быстро отвечаем Telegram, основную обработку переносим в фон.
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(`{"ok":true}`))
 
-	h.processAsync(upd.Message, text)
+	h.processAsync(reqID, msg, text, edited)
 }
 
 func (h *WebhookHandler) handleCommand(ctx context.Context, msg *Message, text string) {
@@ -129,133 +266,451 @@ func (h *WebhookHandler) handleCommand(ctx context.Context, msg *Message, text s
 	if len(parts) > 1 {
 		arg = strings.TrimSpace(parts[1])
 	}
+	cmd, ours := h.normalizeCommand(ctx, cmd)
+	if !ours {
+		return
+	}
+	// Любая своя команда отменяет ожидание ввода, например пароля после /login.
+	h.clearPending(msg.From.ID)
+	h.audit(ctx, msg, cmd)
 
 	switch cmd {
 	case "/start":
-		h.reply(ctx, msg.Chat.ID, "Привет! Команды: /login, /ask (включает режим вопросов, выход /end), /logout, /me. Введите команду, параметр — отдельным сообщением.")
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgStart))
 	case "/login":
+		// Пароль в группе увидят все участники, а ответ на приглашение ввести его
+		// без упоминания бота до него не дойдет.
+		if msg.Chat.IsGroup() {
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgLoginPrivateOnly))
+			return
+		}
 		if arg == "" {
 			h.setPending(msg.From.ID, pendingCommandLogin)
-			h.reply(ctx, msg.Chat.ID, "Введите пароль следующим сообщением")
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgEnterPassword))
 			return
 		}
 		h.handleLogin(ctx, msg, arg)
 	case "/logout":
 		h.auth.Logout(ctx, msg.From.ID)
-		h.setAskMode(msg.From.ID, false)
-		h.clearPending(msg.From.ID)
-		h.reply(ctx, msg.Chat.ID, "Вы вышли")
+		h.resetUserState(ctx, msg.From.ID)
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgLoggedOut))
 	case "/me":
-		authStatus := "не авторизован"
+		authStatus := h.tr(msg, msgStatusAnonymous)
 		if h.auth.IsAuthorized(ctx, msg.From.ID) {
-			authStatus = "авторизован"
+			authStatus = h.tr(msg, msgStatusAuthorized)
 		}
-		h.reply(ctx, msg.Chat.ID, fmt.Sprintf("Ваш id: %d, статус: %s", msg.From.ID, authStatus))
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgMe, msg.From.ID, authStatus))
+	case "/whoami":
+		h.handleWhoami(ctx, msg)
 	case "/ask":
 		if !h.auth.IsAuthorized(ctx, msg.From.ID) {
-			h.reply(ctx, msg.Chat.ID, "Требуется авторизация. Отправьте /login, затем пароль отдельным сообщением.")
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAuthRequired))
 			return
 		}
 		h.setAskMode(msg.From.ID, true)
-		h.reply(ctx, msg.Chat.ID, "Режим вопросов включен. Отправляйте сообщения — я буду отвечать. Команда /end выключит режим.")
+		if h.askMemory {
+			h.startDialog(ctx, msg.From.ID)
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAskModeMemory))
+		} else {
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAskMode))
+		}
 		if arg != "" {
-			h.handleAsk(ctx, msg, arg)
+			h.handleAsk(ctx, msg, commandArg(msg, text, arg))
 		}
 	case "/end":
 		if h.isAskMode(msg.From.ID) {
-			h.setAskMode(msg.From.ID, false)
-			h.reply(ctx, msg.Chat.ID, "Режим вопросов выключен.")
+			h.resetUserState(ctx, msg.From.ID)
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAskModeOff))
 		} else {
-			h.reply(ctx, msg.Chat.ID, "Вы не в режиме вопросов. Отправьте /ask, чтобы начать.")
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgNotInAskMode))
+		}
+	case "/lang":
+		lang := normalizeLang(arg)
+		if lang == "" {
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgLangUsage))
+			return
 		}
+		h.setLang(msg.From.ID, lang)
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgLangChanged))
+	case "/broadcast":
+		h.handleBroadcast(ctx, msg, arg)
+	case "/stats":
+		h.handleStats(ctx, msg)
 	default:
-		h.reply(ctx, msg.Chat.ID, "Неизвестная команда. Попробуйте /start")
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgUnknownCommand))
 	}
 }
 
+// normalizeCommand убирает суффикс "@username" бота, с которым команды приходят в группах
+// ("/ask@MyBot"). Команды, адресованные другому боту, не наши: ours == false.
+// Если имя бота узнать не удалось, суффикс просто отбрасывается.
+func (h *WebhookHandler) normalizeCommand(ctx context.Context, cmd string) (string, bool) {
+	at := strings.IndexByte(cmd, '@')
+	if at < 0 {
+		return cmd, true
+	}
+	target := cmd[at+1:]
+	if username := h.username(ctx); username != "" && !strings.EqualFold(target, username) {
+		return "", false
+	}
+	return cmd[:at], true
+}
+
 func (h *WebhookHandler) handleText(ctx context.Context, msg *Message, text string) {
 	if !h.auth.IsAuthorized(ctx, msg.From.ID) {
-		h.reply(ctx, msg.Chat.ID, "Нужно войти: отправьте /login и затем пароль отдельным сообщением")
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgLoginRequired))
 		return
 	}
 
 	if h.isAskMode(msg.From.ID) {
-		h.handleAsk(ctx, msg, text)
+		h.handleAsk(ctx, msg, renderedText(msg, text))
 		return
 	}
 
-	h.reply(ctx, msg.Chat.ID, "Чтобы задать вопрос, включите режим /ask. Команда /end выключает режим.")
+	h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAskHint))
+}
+
+// renderedText возвращает text с восстановленной разметкой сообщения. Это возможно,
+// только если text — исходное сообщение целиком: после вырезания упоминания в группе
+// смещения сущностей уже не совпадают, и text возвращается как есть.
+func renderedText(msg *Message, text string) string {
+	if text != strings.TrimSpace(msg.Text) {
+		return text
+	}
+	return strings.TrimSpace(renderEntities(msg.Text, msg.Entities))
+}
+
+// commandArg возвращает аргумент команды text с восстановленной разметкой. Команда
+// стоит в начале сообщения раньше любых сущностей, поэтому аргумент отделяется уже
+// после рендеринга так же, как в handleCommand. Если разметку восстановить нельзя,
+// возвращается arg.
+func commandArg(msg *Message, text, arg string) string {
+	rendered := renderedText(msg, text)
+	if rendered == text {
+		return arg
+	}
+	parts := strings.SplitN(rendered, " ", 2)
+	if len(parts) < 2 {
+		return arg
+	}
+	return strings.TrimSpace(parts[1])
 }
 
 func (h *WebhookHandler) handleLogin(ctx context.Context, msg *Message, password string) {
 	if password == "" {
 		h.setPending(msg.From.ID, pendingCommandLogin)
-		h.reply(ctx, msg.Chat.ID, "Введите пароль следующим сообщением")
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgEnterPassword))
 		return
 	}
 	_, err := h.auth.Login(ctx, msg.From.ID, password)
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgTooManyAttempts))
+		return
+	}
+	if err != nil {
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAuthError))
+		return
+	}
+	h.reply(ctx, msg.Chat.ID, h.tr(msg, msgLoggedIn))
+}
+
+// handleWhoami отправляет пользователю сведения о нем для самодиагностики:
+// id, username, статус и роль, срок сессии и текущий режим.
+func (h *WebhookHandler) handleWhoami(ctx context.Context, msg *Message) {
+	username := "—"
+	if msg.From.Username != "" {
+		username = "@" + msg.From.Username
+	}
+
+	status, expiry := h.tr(msg, msgStatusAnonymous), "—"
+	if session, ok := h.auth.Session(ctx, msg.From.ID); ok {
+		role := session.Role
+		if role == "" {
+			role = auth.RoleUser
+		}
+		status = fmt.Sprintf("%s (%s)", h.tr(msg, msgStatusAuthorized), role)
+		expiry = h.tr(msg, msgSessionForever)
+		if !session.ExpiresAt.IsZero() {
+			expiry = h.tr(msg, msgSessionUntil, session.ExpiresAt.UTC().Format("2006-01-02 15:04 MST"))
+		}
+	}
+
+	mode := h.tr(msg, msgModeDefault)
+	if h.isAskMode(msg.From.ID) {
+		mode = h.tr(msg, msgModeAsk)
+		if h.askMemory {
+			mode = h.tr(msg, msgModeAskMemory)
+		}
+	}
+
+	h.reply(ctx, msg.Chat.ID, h.tr(msg, msgWhoami, msg.From.ID, username, status, expiry, mode))
+}
+
+// handleStats отправляет администратору сводку: активные сессии и диалоги,
+// занятые воркеры, отброшенные из-за них update и время работы.
+func (h *WebhookHandler) handleStats(ctx context.Context, msg *Message) {
+	if !h.auth.IsAuthorizedRole(ctx, msg.From.ID, auth.RoleAdmin) {
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAdminOnly))
+		return
+	}
+
+	userIDs, err := h.auth.AuthorizedUserIDs(ctx)
+	if err != nil {
+		h.log(ctx).Error("list authorized users failed", slog.String("error", err.Error()))
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgStatsFailed))
+		return
+	}
+	dialogs := 0
+	if h.dialogs != nil {
+		if dialogs, err = h.dialogs.Count(ctx); err != nil {
+			h.log(ctx).Error("count dialogs failed", slog.String("error", err.Error()))
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgStatsFailed))
+			return
+		}
+	}
+
+	uptime := time.Since(h.startedAt).Truncate(time.Second)
+	h.reply(ctx, msg.Chat.ID, h.tr(msg, msgStats, len(userIDs), dialogs, len(h.sem), cap(h.sem), h.DroppedUpdates(), uptime))
+}
+
+// handleBroadcast рассылает текст всем авторизованным пользователям (кроме автора).
+// Сообщения отправляются с паузой broadcastDelay; если время обработки обновления
+// истекло, рассылка прерывается, а автор получает число доставленных сообщений.
+func (h *WebhookHandler) handleBroadcast(ctx context.Context, msg *Message, text string) {
+	if !h.auth.IsAuthorizedRole(ctx, msg.From.ID, auth.RoleAdmin) {
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAdminOnly))
+		return
+	}
+	if text == "" {
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgBroadcastUsage))
+		return
+	}
+
+	userIDs, err := h.auth.AuthorizedUserIDs(ctx)
 	if err != nil {
-		h.reply(ctx, msg.Chat.ID, "Ошибка авторизации")
+		h.log(ctx).Error("list authorized users failed", slog.String("error", err.Error()))
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgBroadcastListFail))
 		return
 	}
-	h.reply(ctx, msg.Chat.ID, "Вы успешно вошли")
+
+	recipients := make([]int64, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID != msg.From.ID {
+			recipients = append(recipients, userID)
+		}
+	}
+
+	sent := 0
+	for i, userID := range recipients {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(h.broadcastDelay):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err := h.bot.SendMessage(ctx, userID, "📢 "+text); err != nil {
+			h.log(ctx).Warn("broadcast send failed",
+				slog.Int64("user_id", userID),
+				slog.String("error", err.Error()))
+			continue
+		}
+		sent++
+	}
+	// Итог отправляем и после истечения таймаута обработки, иначе автор не узнает о сбое.
+	h.reply(context.WithoutCancel(ctx), msg.Chat.ID, h.tr(msg, msgBroadcastDone, sent, len(recipients)))
 }
 
 func (h *WebhookHandler) handleAsk(ctx context.Context, msg *Message, question string) {
 	if question == "" {
-		h.reply(ctx, msg.Chat.ID, "Нужно задать вопрос. Отправьте текст следующим сообщением")
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgEmptyQuestion))
 		return
 	}
 	if !h.auth.IsAuthorized(ctx, msg.From.ID) {
-		h.reply(ctx, msg.Chat.ID, "Требуется авторизация. Отправьте /login, затем пароль отдельным сообщением.")
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAuthRequired))
 		return
 	}
 
-	h.reply(ctx, msg.Chat.ID, "Думаю...")
-
-	answer, err := h.llm.ChatCompletion(ctx, question, "")
+	h.reply(ctx, msg.Chat.ID, h.tr(msg, msgThinking))
+
+	var (
+		answer       string
+		meta         llm.Meta
+		err          error
+		systemPrompt = h.languageHint(msg)
+	)
+	metaCtx, collected := llm.WithMeta(ctx)
+	switch dialogID := h.getDialogID(msg.From.ID); {
+	case dialogID != "":
+		answer, meta, err = h.dialogs.ChatWithMeta(ctx, dialogID, systemPrompt, question, "")
+	case systemPrompt != "":
+		answer, err = h.llm.ChatWithMessages(metaCtx, "", []llm.Message{
+			{Role: llm.RoleSystem, Content: systemPrompt},
+			{Role: llm.RoleUser, Content: question},
+		})
+		meta = collected()
+	default:
+		answer, err = h.llm.ChatCompletion(metaCtx, question, "")
+		meta = collected()
+	}
 	if err != nil {
-		h.logger.Error("llm error", slog.String("error", err.Error()))
-		h.reply(ctx, msg.Chat.ID, "Ошибка LLM. Попробуйте позже.")
+		h.log(ctx).Error("llm error", slog.String("error", err.Error()))
+		if errors.Is(err, llm.ErrEmptyResponse) {
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgLLMEmpty))
+			return
+		}
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgLLMError))
 		return
 	}
-	h.reply(ctx, msg.Chat.ID, answer)
+	plain := RenderPlain(answer)
+	// Пометка о резервной модели добавляется только к сообщению, в историю диалога она не попадает.
+	if meta.Fallback {
+		answer += "\n\n" + h.tr(msg, msgFallbackModel, markdownEscaper.Replace(meta.Model))
+		plain += "\n\n" + h.tr(msg, msgFallbackModel, meta.Model)
+	}
+	h.replyFormatted(ctx, msg, answer, plain)
 }
 
 func (h *WebhookHandler) reply(ctx context.Context, chatID int64, text string) {
 	if err := h.bot.SendMessage(ctx, chatID, text); err != nil {
-		h.logger.Error("send message failed", slog.String("error", err.Error()))
+		h.log(ctx).Error("send message failed", slog.String("error", err.Error()))
+	}
+}
+
+// replyTo отвечает на конкретное сообщение. Если исходное сообщение уже удалено
+// или Telegram отклонил ответ, отправляет обычное сообщение.
+func (h *WebhookHandler) replyTo(ctx context.Context, msg *Message, text string) {
+	if msg.MessageID == 0 {
+		h.reply(ctx, msg.Chat.ID, text)
+		return
+	}
+	if err := h.bot.SendReply(ctx, msg.Chat.ID, msg.MessageID, text); err != nil {
+		h.log(ctx).Warn("send reply failed, falling back to plain message", slog.String("error", err.Error()))
+		h.reply(ctx, msg.Chat.ID, text)
+	}
+}
+
+// replyFormatted отвечает на msg текстом с разметкой Markdown. Простой вариант plain
+// отправляется, только если Telegram не смог разобрать разметку: ответы модели не всегда
+// укладываются в синтаксис Telegram.
+func (h *WebhookHandler) replyFormatted(ctx context.Context, msg *Message, formatted, plain string) {
+	err := h.bot.SendMarkdown(ctx, msg.Chat.ID, msg.MessageID, formatted)
+	if err != nil && msg.MessageID != 0 && !IsParseError(err) {
+		h.log(ctx).Warn("send reply failed, falling back to plain message", slog.String("error", err.Error()))
+		err = h.bot.SendMarkdown(ctx, msg.Chat.ID, 0, formatted)
+	}
+	if err == nil {
+		return
 	}
+	if IsParseError(err) {
+		h.log(ctx).Warn("markdown rejected, sending plain text", slog.String("error", err.Error()))
+		h.replyTo(ctx, msg, plain)
+		return
+	}
+	h.log(ctx).Error("send message failed", slog.String("error", err.Error()))
 }
 
-func (h *WebhookHandler) processAsync(msg *Message, text string) {
-	if !h.acquireSlot() {
+// processAsync обрабатывает обновление в фоне. Идентификатор запроса вебхука
+// переносится в context фоновой обработки, чтобы ее логи можно было связать с запросом.
+//
+// Очередь пользователя занимается в горутине ServeHTTP, чтобы порядок совпадал с порядком
+// доставки, а воркер — только когда подошла очередь: ожидающие обновления одного
+// пользователя не должны занимать воркеры, нужные другим.
+func (h *WebhookHandler) processAsync(reqID string, msg *Message, text string, edited bool) {
+	prev, own, ok := h.serial.enqueue(msg.From.ID)
+	if !ok {
+		h.logger.Warn("webhook update dropped: user queue is full",
+			slog.String("request_id", reqID),
+			slog.Int64("user_id", msg.From.ID))
+		h.notifyBusy(reqID, msg)
 		return
 	}
 
 	go func(msg *Message, text string) {
+		defer h.serial.done(msg.From.ID, own)
+		if prev != nil {
+			<-prev
+		}
+		if !h.acquireSlot(reqID) {
+			h.notifyBusy(reqID, msg)
+			return
+		}
 		defer h.releaseSlot()
 		defer func() {
 			if r := recover(); r != nil {
-				h.logger.Error("webhook goroutine panic recovered", slog.Any("panic", r))
+				h.logger.Error("webhook goroutine panic recovered",
+					slog.Any("panic", r),
+					slog.String("request_id", reqID))
 			}
 		}()
 
-		ctx, cancel := context.WithTimeout(context.Background(), h.processingTTL)
+		ctx, cancel := context.WithTimeout(requestid.NewContext(context.Background(), reqID), h.processingTTL)
 		defer cancel()
 
+		if edited {
+			h.dispatchEdited(ctx, msg, text)
+			return
+		}
 		h.dispatch(ctx, msg, text)
 	}(msg, text)
 }
 
+// notifyBusy сообщает пользователю, что update отброшен из-за занятых воркеров, чтобы
+// он не ждал ответа впустую. Отправка фоновая и ограничена busyNoticeTimeout; в группах
+// и чужих чатах бот молчит. В один чат уведомление уходит не чаще раза в dropLogInterval,
+// чтобы при перегрузке не умножать исходящий трафик.
+func (h *WebhookHandler) notifyBusy(reqID string, msg *Message) {
+	if msg.Chat.IsGroup() || !h.chatAllowed(msg.Chat.ID) || !h.busyNotices.allow(msg.Chat.ID) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(requestid.NewContext(context.Background(), reqID), busyNoticeTimeout)
+		defer cancel()
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgBusy))
+	}()
+}
+
+// dispatchEdited обрабатывает отредактированное сообщение. В режиме вопросов правка
+// считается новым вопросом; команды и прочие правки повторно не выполняются.
+func (h *WebhookHandler) dispatchEdited(ctx context.Context, msg *Message, text string) {
+	if text != "" && !strings.HasPrefix(text, "/") && h.isAskMode(msg.From.ID) {
+		h.dispatch(ctx, msg, text)
+		return
+	}
+	if !h.chatAllowed(msg.Chat.ID) || msg.Chat.IsGroup() {
+		return
+	}
+	h.reply(ctx, msg.Chat.ID, h.tr(msg, msgEditUnsupported))
+}
+
 func (h *WebhookHandler) dispatch(ctx context.Context, msg *Message, text string) {
+	// Чужие чаты не доходят даже до /login. В группах бот молчит, иначе он отвечал бы
+	// отказом на каждую реплику участников.
+	if !h.chatAllowed(msg.Chat.ID) {
+		h.log(ctx).Warn("update from chat outside allowlist", slog.Int64("chat_id", msg.Chat.ID))
+		if !msg.Chat.IsGroup() {
+			h.reply(ctx, msg.Chat.ID, h.tr(msg, msgAccessDenied))
+		}
+		return
+	}
+
+	// В группах бот реагирует только на команды и прямые упоминания.
+	if msg.Chat.IsGroup() && !strings.HasPrefix(text, "/") {
+		stripped, mentioned := stripMention(msg, h.username(ctx))
+		if !mentioned {
+			return
+		}
+		text = stripped
+	}
+
 	if text == "" {
-		h.reply(ctx, msg.Chat.ID, "Пустое сообщение. Используйте /start.")
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgEmptyMessage))
 		return
 	}
 
 	if strings.HasPrefix(text, "/") {
-		h.clearPending(msg.From.ID)
 		h.handleCommand(ctx, msg, text)
 		return
 	}
@@ -268,29 +723,129 @@ func (h *WebhookHandler) dispatch(ctx context.Context, msg *Message, text string
 	h.handleText(ctx, msg, text)
 }
 
+// username возвращает имя бота, запрашивая его через getMe, пока запрос не удастся.
+func (h *WebhookHandler) username(ctx context.Context) string {
+	h.usernameMu.Lock()
+	defer h.usernameMu.Unlock()
+
+	if h.botUsername != "" {
+		return h.botUsername
+	}
+	me, err := h.bot.GetMe(ctx)
+	if err != nil {
+		h.log(ctx).Warn("get bot username failed", slog.String("error", err.Error()))
+		return ""
+	}
+	h.botUsername = me.Username
+	return h.botUsername
+}
+
+func (h *WebhookHandler) chatAllowed(chatID int64) bool {
+	if h.allowedChats == nil {
+		return true
+	}
+	_, ok := h.allowedChats[chatID]
+	return ok
+}
+
 func (h *WebhookHandler) handlePending(ctx context.Context, msg *Message, cmd pendingCommand, text string) {
 	switch cmd {
 	case pendingCommandLogin:
 		h.handleLogin(ctx, msg, text)
 	default:
-		h.reply(ctx, msg.Chat.ID, "Неизвестное состояние. Попробуйте снова отправить команду.")
+		h.reply(ctx, msg.Chat.ID, h.tr(msg, msgUnknownState))
+	}
+}
+
+// tr переводит ключ на язык автора сообщения.
+func (h *WebhookHandler) tr(msg *Message, key string, args ...any) string {
+	return translate(h.userLang(msg), key, args...)
+}
+
+// userLang возвращает язык, выбранный через /lang, иначе язык клиента Telegram, иначе русский.
+func (h *WebhookHandler) userLang(msg *Message) string {
+	if msg.From == nil {
+		return defaultLang
+	}
+	h.stateMu.Lock()
+	lang := h.state[msg.From.ID].lang
+	h.stateMu.Unlock()
+	if lang != "" {
+		return lang
+	}
+	if lang = normalizeLang(msg.From.LanguageCode); lang != "" {
+		return lang
+	}
+	return defaultLang
+}
+
+func (h *WebhookHandler) setLang(userID int64, lang string) {
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+
+	state := h.state[userID]
+	state.lang = lang
+	h.state[userID] = state
+}
+
+// languageHint возвращает системную инструкцию отвечать на языке пользователя
+// (выбранном через /lang или из language_code), если подсказка включена.
+func (h *WebhookHandler) languageHint(msg *Message) string {
+	if !h.languageHints || msg.From == nil {
+		return ""
+	}
+	h.stateMu.Lock()
+	lang := h.state[msg.From.ID].lang
+	h.stateMu.Unlock()
+	if lang == "" {
+		lang = strings.ToLower(msg.From.LanguageCode)
+	}
+	if lang == "" {
+		return ""
 	}
+	return fmt.Sprintf("Отвечай на языке пользователя (код языка: %s), если он явно не попросит другой язык.", lang)
 }
 
-func (h *WebhookHandler) acquireSlot() bool {
+// log возвращает логгер с request_id текущего обновления.
+func (h *WebhookHandler) log(ctx context.Context) *slog.Logger {
+	return h.logger.With(requestid.Attr(ctx))
+}
+
+func (h *WebhookHandler) acquireSlot(reqID string) bool {
 	if h.sem == nil {
 		return true
 	}
 
 	select {
 	case h.sem <- struct{}{}:
+		// Перегрузка могла закончиться: хвост отбросов после последней сводки
+		// попадает в лог с первым обработанным update.
+		if count, ok := h.drops.flush(); ok {
+			h.logDrops(reqID, count)
+		}
 		return true
 	case <-time.After(h.acquireTTL):
-		h.logger.Warn("webhook update dropped: workers are busy")
+		if count, ok := h.drops.add(); ok {
+			h.logDrops(reqID, count)
+		}
 		return false
 	}
 }
 
+func (h *WebhookHandler) logDrops(reqID string, count int64) {
+	h.logger.Warn("webhook updates dropped: workers are busy",
+		slog.Int64("dropped", count),
+		slog.Int64("dropped_total", h.drops.Total()),
+		slog.Duration("interval", dropLogInterval),
+		slog.String("request_id", reqID))
+}
+
+// DroppedUpdates число update, отброшенных из-за занятых воркеров, с момента запуска.
+// Выводится администратору в /stats.
+func (h *WebhookHandler) DroppedUpdates() int64 {
+	return h.drops.Total()
+}
+
 func (h *WebhookHandler) releaseSlot() {
 	if h.sem == nil {
 		return
@@ -350,3 +905,65 @@ func (h *WebhookHandler) isAskMode(userID int64) bool {
 	state, ok := h.state[userID]
 	return ok && state.askMode
 }
+
+// startDialog начинает новый диалог /ask, удаляя историю предыдущего.
+// Идентификатор имеет вид "userID:timestamp".
+func (h *WebhookHandler) startDialog(ctx context.Context, userID int64) {
+	h.endDialog(ctx, userID)
+
+	dialogID := fmt.Sprintf("%d:%d", userID, time.Now().UnixNano())
+	if err := h.dialogs.Start(ctx, dialogID, userID, ""); err != nil {
+		h.log(ctx).Error("start dialog failed", slog.String("error", err.Error()))
+	}
+
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+
+	state := h.state[userID]
+	state.dialogID = dialogID
+	h.state[userID] = state
+}
+
+// resetUserState возвращает пользователя в исходное состояние: выключает режим вопросов,
+// отменяет ожидание ввода и удаляет историю диалога. Выбранный язык сохраняется —
+// это настройка, а не состояние сеанса.
+func (h *WebhookHandler) resetUserState(ctx context.Context, userID int64) {
+	h.endDialog(ctx, userID)
+
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+
+	state, ok := h.state[userID]
+	if !ok {
+		return
+	}
+	if state.lang == "" {
+		delete(h.state, userID)
+		return
+	}
+	h.state[userID] = userState{lang: state.lang}
+}
+
+// endDialog удаляет историю активного диалога пользователя, если он есть.
+func (h *WebhookHandler) endDialog(ctx context.Context, userID int64) {
+	h.stateMu.Lock()
+	state := h.state[userID]
+	dialogID := state.dialogID
+	state.dialogID = ""
+	h.state[userID] = state
+	h.stateMu.Unlock()
+
+	if dialogID == "" || h.dialogs == nil {
+		return
+	}
+	if err := h.dialogs.Reset(ctx, dialogID); err != nil {
+		h.log(ctx).Error("reset dialog failed", slog.String("error", err.Error()))
+	}
+}
+
+func (h *WebhookHandler) getDialogID(userID int64) string {
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+
+	return h.state[userID].dialogID
+}
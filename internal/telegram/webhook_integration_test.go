@@ -11,23 +11,6 @@ import (
 	"time"
 )
 
-type webhookInfoResponse struct {
-	OK          bool        `json:"ok"`
-	Description string      `json:"description"`
-	Result      webhookInfo `json:"result"`
-}
-
-type webhookInfo struct {
-	URL                          string `json:"url"`
-	HasCustomCertificate         bool   `json:"has_custom_certificate"`
-	PendingUpdateCount           int    `json:"pending_update_count"`
-	LastErrorDate                int64  `json:"last_error_date"`
-	LastErrorMessage             string `json:"last_error_message"`
-	LastSynchronizationErrorDate int64  `json:"last_synchronization_error_date"`
-	MaxConnections               int    `json:"max_connections"`
-	IPAddress                    string `json:"ip_address"`
-}
-
 func TestTelegramWebhookInfoViaCurl(t *testing.T) {
 	if testing.Short() {
 		t.Skip("интеграционный тест пропущен в режиме -short")
@@ -4,28 +4,100 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"aiadvent/internal/auth"
+	"aiadvent/internal/llm"
+	"aiadvent/internal/middleware"
+	"aiadvent/internal/requestid"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 	"sync"
 )
 
 type stubBot struct {
 	mu   sync.Mutex
 	msgs []string
+	// replyTo хранит reply_to_message_id для каждого сообщения (0 — обычная отправка).
+	replyTo  []int64
+	chats    []int64
+	replyErr error
+	// markdownErr возвращается на любую отправку с разметкой (например, ошибка разбора).
+	markdownErr error
 }
 
 func (s *stubBot) SendMessage(ctx context.Context, chatID int64, text string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.msgs = append(s.msgs, text)
+	s.replyTo = append(s.replyTo, 0)
+	s.chats = append(s.chats, chatID)
 	return nil
 }
 
+func (s *stubBot) SendReply(ctx context.Context, chatID, replyToID int64, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replyErr != nil {
+		return s.replyErr
+	}
+	s.msgs = append(s.msgs, text)
+	s.replyTo = append(s.replyTo, replyToID)
+	s.chats = append(s.chats, chatID)
+	return nil
+}
+
+func (s *stubBot) SendMarkdown(ctx context.Context, chatID, replyToID int64, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.markdownErr != nil {
+		return s.markdownErr
+	}
+	if replyToID != 0 && s.replyErr != nil {
+		return s.replyErr
+	}
+	s.msgs = append(s.msgs, text)
+	s.replyTo = append(s.replyTo, replyToID)
+	s.chats = append(s.chats, chatID)
+	return nil
+}
+
+func (s *stubBot) SendDocument(ctx context.Context, chatID int64, filename string, data io.Reader, caption string) error {
+	return nil
+}
+
+func (s *stubBot) SetWebhook(ctx context.Context, url, secret string, maxConnections int) error {
+	return nil
+}
+
+func (s *stubBot) DeleteWebhook(ctx context.Context, dropPending bool) error {
+	return nil
+}
+
+func (s *stubBot) GetWebhookInfo(ctx context.Context) (WebhookInfo, error) {
+	return WebhookInfo{}, nil
+}
+
+func (s *stubBot) ReplyIDs() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]int64, len(s.replyTo))
+	copy(result, s.replyTo)
+	return result
+}
+
+func (s *stubBot) GetMe(ctx context.Context) (User, error) {
+	return User{ID: 1, Username: "test_bot"}, nil
+}
+
 func (s *stubBot) Messages() []string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -39,14 +111,35 @@ func (s *stubBot) Reset() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.msgs = nil
+	s.replyTo = nil
+	s.chats = nil
+}
+
+// SentTo возвращает тексты, отправленные в чат chatID.
+func (s *stubBot) SentTo(chatID int64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []string
+	for i, id := range s.chats {
+		if id == chatID {
+			result = append(result, s.msgs[i])
+		}
+	}
+	return result
 }
 
 type stubLLM struct {
 	answer string
+	err    error
 }
 
 func (s *stubLLM) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
-	return s.answer, nil
+	return s.answer, s.err
+}
+
+func (s *stubLLM) ChatWithMessages(ctx context.Context, model string, messages []llm.Message, opts ...llm.ChatOption) (string, error) {
+	return s.answer, s.err
 }
 
 type slowLLM struct {
@@ -63,6 +156,10 @@ func (s *slowLLM) ChatCompletion(ctx context.Context, prompt string, model strin
 	return s.answer, nil
 }
 
+func (s *slowLLM) ChatWithMessages(ctx context.Context, model string, messages []llm.Message, opts ...llm.ChatOption) (string, error) {
+	return s.ChatCompletion(ctx, "", model)
+}
+
 func TestPublicCommandDoesNotRequireAuth(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	bot := &stubBot{}
@@ -89,6 +186,143 @@ func TestPublicCommandDoesNotRequireAuth(t *testing.T) {
 	waitForMessages(t, bot, 1, 500*time.Millisecond)
 }
 
+func TestWebhookRejectsInvalidSecret(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:          auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:           &stubLLM{answer: "ok"},
+		Bot:           bot,
+		Logger:        logger,
+		WebhookSecret: "s3cret",
+	})
+
+	update := Update{Message: &Message{Text: "/start", Chat: Chat{ID: 1}, From: &User{ID: 1}}}
+	body, _ := json.Marshal(update)
+
+	cases := map[string]string{
+		"missing": "",
+		"wrong":   "s3crex",
+		"prefix":  "s3c",
+	}
+	for name, secret := range cases {
+		req := httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body))
+		if secret != "" {
+			req.Header.Set(secretHeader, secret)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("%s secret: expected status 403, got %d", name, rr.Code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body))
+	req.Header.Set(secretHeader, "s3cret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("valid secret: expected status 200, got %d", rr.Code)
+	}
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+}
+
+func TestWebhookRejectsWrongMethodAndContentType(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "ok"},
+		Bot:    &stubBot{},
+		Logger: logger,
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/telegram/webhook", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rr.Code)
+	}
+	if allow := rr.Header().Get("Allow"); allow != http.MethodPost {
+		t.Fatalf("unexpected Allow header: %q", allow)
+	}
+
+	req := httptest.NewRequest("POST", "/telegram/webhook", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected status 415, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/telegram/webhook", strings.NewReader(`{"update_id":1}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for json with charset, got %d", rr.Code)
+	}
+}
+
+func TestWebhookRejectsOversizedBody(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:         auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:          &stubLLM{answer: "ok"},
+		Bot:          bot,
+		Logger:       logger,
+		MaxBodyBytes: 1024,
+	})
+
+	huge := strings.Repeat("a", 4096)
+	body, _ := json.Marshal(Update{Message: &Message{Text: huge, Chat: Chat{ID: 1}, From: &User{ID: 1}}})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413, got %d", rr.Code)
+	}
+
+	small, _ := json.Marshal(Update{Message: &Message{Text: "/start", Chat: Chat{ID: 1}, From: &User{ID: 1}}})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(small)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected small update to pass, got %d", rr.Code)
+	}
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+}
+
+func TestAllowedChatIDs(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:           auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:            &stubLLM{answer: "ok"},
+		Bot:            bot,
+		Logger:         logger,
+		AllowedChatIDs: []int64{1},
+	})
+
+	sendUpdate(t, handler, 2, "/login")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	if got := bot.Messages()[0]; got != "Доступ запрещён" {
+		t.Fatalf("expected denied chat to be rejected before login, got %q", got)
+	}
+
+	sendUpdate(t, handler, 1, "/start")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	if got := bot.Messages()[1]; !strings.HasPrefix(got, "Привет!") {
+		t.Fatalf("expected allowed chat to be served, got %q", got)
+	}
+
+	// В чужой группе бот не отвечает отказом на каждое сообщение.
+	group := Chat{ID: -100, Type: "supergroup"}
+	sendMessage(t, handler, &Message{Text: "всем привет", Chat: group, From: &User{ID: 3}})
+	sendMessage(t, handler, &Message{Text: "/start", Chat: group, From: &User{ID: 3}})
+	time.Sleep(50 * time.Millisecond)
+	if got := bot.SentTo(group.ID); len(got) != 0 {
+		t.Fatalf("expected silence in a group outside allowlist, got %q", got)
+	}
+}
+
 func TestPrivateCommandRequiresAuth(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	bot := &stubBot{}
@@ -132,6 +366,7 @@ func TestPrivateCommandRequiresAuth(t *testing.T) {
 	reqAsk2 := httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(bodyAsk2))
 	rrAsk2 := httptest.NewRecorder()
 	handler.ServeHTTP(rrAsk2, reqAsk2)
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
 
 	updateQuestion := Update{Message: &Message{Text: "hi", Chat: Chat{ID: 1}, From: &User{ID: 7}}}
 	bodyQuestion, _ := json.Marshal(updateQuestion)
@@ -189,3 +424,890 @@ func waitForMessages(t *testing.T, bot *stubBot, min int, timeout time.Duration)
 
 	t.Fatalf("expected at least %d messages, got %d", min, len(bot.Messages()))
 }
+
+type recordingLLM struct {
+	mu    sync.Mutex
+	calls [][]llm.Message
+}
+
+func (r *recordingLLM) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return r.ChatWithMessages(ctx, model, []llm.Message{{Role: llm.RoleUser, Content: prompt}})
+}
+
+func (r *recordingLLM) ChatWithMessages(ctx context.Context, model string, messages []llm.Message, opts ...llm.ChatOption) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, append([]llm.Message(nil), messages...))
+	return "answer", nil
+}
+
+func (r *recordingLLM) Calls() [][]llm.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]llm.Message(nil), r.calls...)
+}
+
+func sendUpdate(t *testing.T, handler *WebhookHandler, userID int64, text string) {
+	t.Helper()
+	sendMessage(t, handler, &Message{Text: text, Chat: Chat{ID: userID}, From: &User{ID: userID}})
+}
+
+func sendMessage(t *testing.T, handler *WebhookHandler, msg *Message) {
+	t.Helper()
+
+	body, _ := json.Marshal(Update{Message: msg})
+	req := httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAskAnswerIsThreadedReply(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "ответ"},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+
+	update := Update{Message: &Message{MessageID: 77, Text: "/ask вопрос", Chat: Chat{ID: 1}, From: &User{ID: 1}}}
+	body, _ := json.Marshal(update)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body)))
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+
+	if got := bot.Messages()[3]; got != "ответ" {
+		t.Fatalf("unexpected answer: %q", got)
+	}
+	if got := bot.ReplyIDs()[3]; got != 77 {
+		t.Fatalf("expected answer to reply to message 77, got %d", got)
+	}
+
+	// Если ответить на сообщение не удалось (например, оно удалено), уходит обычное сообщение.
+	bot.mu.Lock()
+	bot.replyErr = errors.New("message to be replied not found")
+	bot.mu.Unlock()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body)))
+	waitForMessages(t, bot, 7, 500*time.Millisecond)
+	if got := bot.Messages()[6]; got != "ответ" || bot.ReplyIDs()[6] != 0 {
+		t.Fatalf("expected fallback to plain message, got %q", got)
+	}
+}
+
+func TestGroupChatRespondsOnlyToCommandsAndMentions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	model := &recordingLLM{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   authService,
+		LLM:    model,
+		Bot:    bot,
+		Logger: logger,
+	})
+	if _, err := authService.Login(context.Background(), 1, "pass"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	send := func(msg *Message) {
+		msg.Chat = Chat{ID: -100, Type: "supergroup"}
+		msg.From = &User{ID: 1}
+		body, _ := json.Marshal(Update{Message: msg})
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body)))
+	}
+
+	send(&Message{Text: "/me"})
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	send(&Message{Text: "/ask"})
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+
+	// Обычная реплика участника группы боту не адресована.
+	send(&Message{Text: "всем привет"})
+	time.Sleep(50 * time.Millisecond)
+	if got := len(bot.Messages()); got != 2 {
+		t.Fatalf("expected bot to ignore group chatter, got %d messages", got)
+	}
+
+	send(&Message{
+		Text:     "🙂 @test_bot сколько будет 2+2?",
+		Entities: []MessageEntity{{Type: "mention", Offset: 3, Length: 9}},
+	})
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+	calls := model.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected exactly one llm call, got %d", len(calls))
+	}
+	if got := calls[0][len(calls[0])-1].Content; got != "🙂  сколько будет 2+2?" {
+		t.Fatalf("expected mention to be stripped from prompt, got %q", got)
+	}
+}
+
+func TestGroupLoginRedirectsToPrivateChat(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   authService,
+		LLM:    &stubLLM{answer: "ok"},
+		Bot:    bot,
+		Logger: logger,
+	})
+	group := Chat{ID: -100, Type: "supergroup"}
+	const privateOnly = "Войдите в личном чате с ботом: пароль в группе увидят все участники"
+
+	sendMessage(t, handler, &Message{Text: "/login pass", Chat: group, From: &User{ID: 1}})
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	if got := bot.Messages()[0]; got != privateOnly {
+		t.Fatalf("expected group login to be refused, got %q", got)
+	}
+	if authService.IsAuthorized(context.Background(), 1) {
+		t.Fatal("expected no session after group login")
+	}
+
+	// Без пароля бот тоже не ждет его в группе.
+	sendMessage(t, handler, &Message{Text: "/login@test_bot", Chat: group, From: &User{ID: 1}})
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	if got := bot.Messages()[1]; got != privateOnly {
+		t.Fatalf("expected group login to be refused, got %q", got)
+	}
+	if _, ok := handler.popPending(1); ok {
+		t.Fatal("expected no pending login after group /login")
+	}
+
+	// В личном чате вход работает как обычно.
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+	if !authService.IsAuthorized(context.Background(), 1) {
+		t.Fatalf("expected private login to succeed, got %q", bot.Messages()[2])
+	}
+}
+
+func TestPrivateChatAnswersWithoutMention(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "ответ"},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/ask")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "вопрос")
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+	if got := bot.Messages()[3]; got != "ответ" {
+		t.Fatalf("unexpected answer: %q", got)
+	}
+}
+
+func TestDuplicateUpdateIsDispatchedOnce(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:        auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:         &stubLLM{answer: "ok"},
+		Bot:         bot,
+		Logger:      logger,
+		DedupWindow: time.Minute,
+	})
+
+	body, _ := json.Marshal(Update{UpdateID: 1001, Message: &Message{Text: "/start", Chat: Chat{ID: 1}, From: &User{ID: 1}}})
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("delivery %d: expected status 200, got %d", i+1, rr.Code)
+		}
+	}
+
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if got := len(bot.Messages()); got != 1 {
+		t.Fatalf("expected duplicate update to be skipped, got %d messages", got)
+	}
+}
+
+func TestUpdateDeduperForgetsAfterWindow(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := newUpdateDeduper(time.Minute)
+	d.now = func() time.Time { return now }
+
+	if d.Seen(1) {
+		t.Fatalf("first delivery must not be a duplicate")
+	}
+	now = now.Add(30 * time.Second)
+	if !d.Seen(1) {
+		t.Fatalf("repeat within window must be a duplicate")
+	}
+	now = now.Add(2 * time.Minute)
+	if d.Seen(1) {
+		t.Fatalf("id should be forgotten after the window")
+	}
+}
+
+type ctxRecordingLLM struct {
+	mu         sync.Mutex
+	requestIDs []string
+}
+
+func (c *ctxRecordingLLM) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requestIDs = append(c.requestIDs, requestid.FromContext(ctx))
+	return "ok", nil
+}
+
+func (c *ctxRecordingLLM) ChatWithMessages(ctx context.Context, model string, messages []llm.Message, opts ...llm.ChatOption) (string, error) {
+	return c.ChatCompletion(ctx, "", model)
+}
+
+func TestRequestIDReachesLLMCall(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	model := &ctxRecordingLLM{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    model,
+		Bot:    bot,
+		Logger: logger,
+	})
+	withRequestID := middleware.RequestID(handler)
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+
+	body, _ := json.Marshal(Update{Message: &Message{Text: "/ask вопрос", Chat: Chat{ID: 1}, From: &User{ID: 1}}})
+	req := httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body))
+	req.Header.Set(requestid.Header, "req-42")
+	withRequestID.ServeHTTP(httptest.NewRecorder(), req)
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+	if len(model.requestIDs) != 1 || model.requestIDs[0] != "req-42" {
+		t.Fatalf("expected request id to reach llm call, got %v", model.requestIDs)
+	}
+}
+
+func TestBroadcastReachesAuthorizedUsers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	authService := auth.NewServiceWithRoles(map[string]auth.Role{
+		"root":  auth.RoleAdmin,
+		"guest": auth.RoleUser,
+	}, time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:           authService,
+		LLM:            &stubLLM{answer: "ok"},
+		Bot:            bot,
+		Logger:         logger,
+		BroadcastDelay: time.Millisecond,
+	})
+
+	ctx := context.Background()
+	for userID, password := range map[int64]string{1: "root", 2: "guest", 3: "guest", 4: "guest"} {
+		if _, err := authService.Login(ctx, userID, password); err != nil {
+			t.Fatalf("login %d: %v", userID, err)
+		}
+	}
+	authService.Logout(ctx, 4)
+
+	sendUpdate(t, handler, 2, "/broadcast нельзя")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	if got := bot.SentTo(2); len(got) != 1 || got[0] != "Команда доступна только администратору" {
+		t.Fatalf("expected non-admin to be rejected, got %v", got)
+	}
+	bot.Reset()
+
+	sendUpdate(t, handler, 1, "/broadcast Плановые работы в 22:00")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+	for _, userID := range []int64{2, 3} {
+		if got := bot.SentTo(userID); len(got) != 1 || got[0] != "📢 Плановые работы в 22:00" {
+			t.Fatalf("user %d: unexpected broadcast %v", userID, got)
+		}
+	}
+	if got := bot.SentTo(4); len(got) != 0 {
+		t.Fatalf("logged out user must not receive broadcast, got %v", got)
+	}
+	if got := bot.SentTo(1); len(got) != 1 || got[0] != "Рассылка отправлена: 2 из 2" {
+		t.Fatalf("unexpected admin report: %v", got)
+	}
+}
+
+func TestStatsForAdminOnly(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	authService := auth.NewServiceWithRoles(map[string]auth.Role{
+		"root":  auth.RoleAdmin,
+		"guest": auth.RoleUser,
+	}, time.Hour, auth.NewMemoryStore())
+	dialogs := llm.NewDialogService(&stubLLM{answer: "ok"}, llm.NewMemoryDialogStore(time.Hour, 0), llm.DialogServiceConfig{})
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:       authService,
+		LLM:        &stubLLM{answer: "ok"},
+		Bot:        bot,
+		Logger:     logger,
+		Dialogs:    dialogs,
+		MaxWorkers: 4,
+	})
+
+	ctx := context.Background()
+	for userID, password := range map[int64]string{1: "root", 2: "guest", 3: "guest"} {
+		if _, err := authService.Login(ctx, userID, password); err != nil {
+			t.Fatalf("login %d: %v", userID, err)
+		}
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := dialogs.Start(ctx, id, 2, ""); err != nil {
+			t.Fatalf("start dialog: %v", err)
+		}
+	}
+
+	sendUpdate(t, handler, 2, "/stats")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	if got := bot.Messages()[0]; got != "Команда доступна только администратору" {
+		t.Fatalf("expected non-admin to be rejected, got %q", got)
+	}
+
+	sendUpdate(t, handler, 1, "/stats")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	got := bot.Messages()[1]
+	for _, want := range []string{"Сессий: 3", "Диалогов: 2", "Воркеры: 1 из 4", "Отброшено update: 0", "Аптайм: "} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in stats, got %q", want, got)
+		}
+	}
+}
+
+func TestLogoutResetsAllState(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	dialogs := llm.NewDialogService(&stubLLM{answer: "ok"}, llm.NewMemoryDialogStore(time.Hour, 0), llm.DialogServiceConfig{})
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:      authService,
+		LLM:       &stubLLM{answer: "ok"},
+		Bot:       bot,
+		Logger:    logger,
+		Dialogs:   dialogs,
+		AskMemory: true,
+	})
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/ask вопрос")
+	// Включение режима, "Думаю..." и ответ.
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+	if count, _ := dialogs.Count(context.Background()); count != 1 {
+		t.Fatalf("expected active dialog before logout, got %d", count)
+	}
+	sendUpdate(t, handler, 1, "/login")
+	waitForMessages(t, bot, 5, 500*time.Millisecond)
+
+	sendUpdate(t, handler, 1, "/logout")
+	waitForMessages(t, bot, 6, 500*time.Millisecond)
+	if got := bot.Messages()[5]; got != "Вы вышли" {
+		t.Fatalf("expected logout confirmation, got %q", got)
+	}
+
+	if authService.IsAuthorized(context.Background(), 1) {
+		t.Fatalf("session must be removed on logout")
+	}
+	if handler.isAskMode(1) {
+		t.Fatalf("ask mode must be reset on logout")
+	}
+	if count, _ := dialogs.Count(context.Background()); count != 0 {
+		t.Fatalf("dialog history must be removed on logout, got %d dialogs", count)
+	}
+
+	// Ожидание пароля тоже сброшено: текст не считается паролем.
+	sendUpdate(t, handler, 1, "pass")
+	waitForMessages(t, bot, 7, 500*time.Millisecond)
+	if got := bot.Messages()[6]; got != "Нужно войти: отправьте /login и затем пароль отдельным сообщением" {
+		t.Fatalf("expected pending login to be cleared, got %q", got)
+	}
+}
+
+func TestResetUserStateKeepsOnlyLanguage(t *testing.T) {
+	dialogs := llm.NewDialogService(&stubLLM{answer: "ok"}, llm.NewMemoryDialogStore(time.Hour, 0), llm.DialogServiceConfig{})
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:    auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:     &stubLLM{answer: "ok"},
+		Bot:     &stubBot{},
+		Logger:  slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		Dialogs: dialogs,
+	})
+	ctx := context.Background()
+
+	handler.startDialog(ctx, 1)
+	handler.setAskMode(1, true)
+	handler.setPending(1, pendingCommandLogin)
+	handler.setLang(1, langEN)
+	handler.resetUserState(ctx, 1)
+
+	if got := handler.state[1]; got != (userState{lang: langEN}) {
+		t.Fatalf("expected only language to survive reset, got %+v", got)
+	}
+	if count, _ := dialogs.Count(ctx); count != 0 {
+		t.Fatalf("expected dialog to be removed, got %d", count)
+	}
+
+	handler.setAskMode(2, true)
+	handler.resetUserState(ctx, 2)
+	if _, ok := handler.state[2]; ok {
+		t.Fatalf("expected empty state to be removed entirely")
+	}
+}
+
+func TestEndClearsPendingInput(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "ok"},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/ask")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/login")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/end")
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+
+	sendUpdate(t, handler, 1, "pass")
+	waitForMessages(t, bot, 5, 500*time.Millisecond)
+	if got := bot.Messages()[4]; got != "Чтобы задать вопрос, включите режим /ask. Команда /end выключает режим." {
+		t.Fatalf("expected pending input to be cleared by /end, got %q", got)
+	}
+}
+
+func TestUpdatesOfOneUserAreProcessedInOrder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:       authService,
+		LLM:        &stubLLM{answer: "ответ"},
+		Bot:        bot,
+		Logger:     logger,
+		MaxWorkers: 64,
+	})
+
+	const users = 20
+	for userID := int64(1); userID <= users; userID++ {
+		if _, err := authService.Login(context.Background(), userID, "pass"); err != nil {
+			t.Fatalf("login: %v", err)
+		}
+	}
+	// Вопрос уходит сразу за /ask, не дожидаясь ответа: он должен попасть уже в режим вопросов.
+	for userID := int64(1); userID <= users; userID++ {
+		sendUpdate(t, handler, userID, "/ask")
+		sendUpdate(t, handler, userID, "вопрос")
+	}
+	waitForMessages(t, bot, users*3, 2*time.Second)
+
+	for userID := int64(1); userID <= users; userID++ {
+		got := bot.SentTo(userID)
+		want := []string{
+			"Режим вопросов включен. Отправляйте сообщения — я буду отвечать. Команда /end выключит режим.",
+			"Думаю...",
+			"ответ",
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Fatalf("user %d: unexpected order %q", userID, got)
+		}
+	}
+}
+
+func TestBusyMessageWhenWorkersSaturated(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:           authService,
+		LLM:            &slowLLM{delay: 300 * time.Millisecond, answer: "ответ"},
+		Bot:            bot,
+		Logger:         logger,
+		MaxWorkers:     1,
+		AcquireTimeout: 10 * time.Millisecond,
+	})
+	if _, err := authService.Login(context.Background(), 1, "pass"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	sendUpdate(t, handler, 1, "/ask долгий вопрос")
+	// Ждем, пока первый update займет единственный воркер.
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	sendUpdate(t, handler, 2, "/start")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+
+	if got := bot.SentTo(2); len(got) != 1 || got[0] != "Сервис занят, попробуйте через минуту" {
+		t.Fatalf("expected busy message for dropped update, got %v", got)
+	}
+	if dropped := handler.DroppedUpdates(); dropped != 1 {
+		t.Fatalf("expected dropped counter to be 1, got %d", dropped)
+	}
+}
+
+func TestFloodingUserDoesNotStarveOthers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:           authService,
+		LLM:            &slowLLM{delay: 300 * time.Millisecond, answer: "ответ"},
+		Bot:            bot,
+		Logger:         logger,
+		MaxWorkers:     2,
+		AcquireTimeout: 10 * time.Millisecond,
+	})
+	if _, err := authService.Login(context.Background(), 1, "pass"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	// Пользователь 1 шлет вопросы один за другим, пока первый еще обрабатывается.
+	for i := 0; i < 5; i++ {
+		sendUpdate(t, handler, 1, "/ask вопрос")
+	}
+	time.Sleep(50 * time.Millisecond)
+	sendUpdate(t, handler, 2, "/me")
+
+	deadline := time.Now().Add(time.Second)
+	for len(bot.SentTo(2)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := bot.SentTo(2); len(got) != 1 || !strings.HasPrefix(got[0], "Ваш id: 2") {
+		t.Fatalf("expected user 2 to be served while user 1 floods, got %v", got)
+	}
+
+	// Сверх очереди пользователя обновления отбрасываются, уведомление — одно на чат.
+	busy := 0
+	for _, text := range bot.SentTo(1) {
+		if text == "Сервис занят, попробуйте через минуту" {
+			busy++
+		}
+	}
+	if busy != 1 {
+		t.Fatalf("expected a single busy notice for user 1, got %d: %v", busy, bot.SentTo(1))
+	}
+}
+
+func TestForeignBotCommandKeepsPendingLogin(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   authService,
+		LLM:    &stubLLM{answer: "ok"},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	sendUpdate(t, handler, 1, "/login")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	// Команда другому боту игнорируется и не сбрасывает ожидание пароля.
+	sendUpdate(t, handler, 1, "/start@other_bot")
+	sendUpdate(t, handler, 1, "pass")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+
+	if got := bot.Messages()[1]; got != "Вы успешно вошли" {
+		t.Fatalf("expected pending login to survive a foreign command, got %q", got)
+	}
+}
+
+func TestCommandWithBotUsernameSuffix(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	model := &recordingLLM{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   authService,
+		LLM:    model,
+		Bot:    bot,
+		Logger: logger,
+	})
+	if _, err := authService.Login(context.Background(), 1, "pass"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	group := Chat{ID: -100, Type: "supergroup"}
+
+	sendMessage(t, handler, &Message{Text: "/ask@Test_Bot сколько будет 2+2?", Chat: group, From: &User{ID: 1}})
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+	calls := model.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected /ask@bot to reach the model, got %d calls", len(calls))
+	}
+	if got := calls[0][len(calls[0])-1].Content; got != "сколько будет 2+2?" {
+		t.Fatalf("expected argument to be preserved, got %q", got)
+	}
+
+	// Команда другому боту в той же группе не обрабатывается.
+	sendMessage(t, handler, &Message{Text: "/start@other_bot", Chat: group, From: &User{ID: 1}})
+	sendMessage(t, handler, &Message{Text: "/me@test_bot", Chat: group, From: &User{ID: 1}})
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	messages := bot.Messages()
+	if len(messages) != 4 || !strings.HasPrefix(messages[3], "Ваш id: 1") {
+		t.Fatalf("expected only /me@test_bot to be answered, got %q", messages)
+	}
+}
+
+func TestWhoamiShowsSessionAndMode(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "ok"},
+		Bot:    bot,
+		Logger: logger,
+	})
+	whoami := &Message{Text: "/whoami", Chat: Chat{ID: 5}, From: &User{ID: 5, Username: "alice"}}
+
+	sendMessage(t, handler, whoami)
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	got := bot.Messages()[0]
+	for _, want := range []string{"ID: 5", "Username: @alice", "Статус: не авторизован", "Сессия: —", "Режим: обычный"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in anonymous whoami, got %q", want, got)
+		}
+	}
+
+	sendUpdate(t, handler, 5, "/login pass")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	sendUpdate(t, handler, 5, "/ask")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+	sendMessage(t, handler, whoami)
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+	got = bot.Messages()[3]
+	for _, want := range []string{"Статус: авторизован (admin)", "Сессия: до ", "Режим: вопросы (/ask)"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in whoami, got %q", want, got)
+		}
+	}
+}
+
+func TestAskEmptyModelResponse(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{err: fmt.Errorf("openrouter: %w", llm.ErrEmptyResponse)},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/ask вопрос")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+
+	messages := bot.Messages()
+	if got := messages[len(messages)-1]; got != "Модель вернула пустой ответ, попробуйте переформулировать" {
+		t.Fatalf("expected empty-response message, got %q", got)
+	}
+}
+
+func TestAskAnswerSentWithMarkdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "## Ответ\n- **первый** пункт\n- `код`"},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/ask вопрос")
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+
+	messages := bot.Messages()
+	if got := messages[len(messages)-1]; got != "## Ответ\n- **первый** пункт\n- `код`" {
+		t.Fatalf("expected formatted answer to be sent as is, got %q", got)
+	}
+}
+
+func TestAskAnswerRenderedAsPlainTextWhenMarkdownRejected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{markdownErr: &TelegramAPIError{
+		Method:      "sendMessage",
+		StatusCode:  400,
+		ErrorCode:   400,
+		Description: "Bad Request: can't parse entities: Can't find end of the entity",
+	}}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "## Ответ\n- **первый** пункт\n- `код`"},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/ask вопрос")
+	waitForMessages(t, bot, 4, 500*time.Millisecond)
+
+	messages := bot.Messages()
+	if got := messages[len(messages)-1]; got != "Ответ\n• первый пункт\n• код" {
+		t.Fatalf("expected plain text answer, got %q", got)
+	}
+}
+
+func TestDecodeEditedMessage(t *testing.T) {
+	payload := `{"update_id":10,"edited_message":{"message_id":5,"text":"исправленный вопрос","chat":{"id":7},"from":{"id":7,"username":"u"}}}`
+
+	var upd Update
+	if err := json.Unmarshal([]byte(payload), &upd); err != nil {
+		t.Fatalf("decode update: %v", err)
+	}
+	if upd.Message != nil {
+		t.Fatalf("message should be empty for edited update")
+	}
+	if upd.EditedMessage == nil || upd.EditedMessage.Text != "исправленный вопрос" || upd.EditedMessage.From.ID != 7 {
+		t.Fatalf("unexpected edited message: %+v", upd.EditedMessage)
+	}
+}
+
+func TestEditedMessageInAskModeIsAnswered(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:   auth.NewService("pass", time.Hour, auth.NewMemoryStore()),
+		LLM:    &stubLLM{answer: "ответ"},
+		Bot:    bot,
+		Logger: logger,
+	})
+
+	sendEdited := func(text string) {
+		update := Update{EditedMessage: &Message{Text: text, Chat: Chat{ID: 1}, From: &User{ID: 1}}}
+		body, _ := json.Marshal(update)
+		req := httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	sendEdited("вопрос")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	if got := bot.Messages()[0]; !strings.HasPrefix(got, "Редактирование сообщений не поддерживается") {
+		t.Fatalf("expected edit outside ask mode to be ignored with a note, got %q", got)
+	}
+
+	sendUpdate(t, handler, 1, "/login pass")
+	waitForMessages(t, bot, 2, 500*time.Millisecond)
+	sendUpdate(t, handler, 1, "/ask")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+
+	sendEdited("вопрос")
+	waitForMessages(t, bot, 5, 500*time.Millisecond)
+	if got := bot.Messages()[4]; got != "ответ" {
+		t.Fatalf("expected edited question to be answered, got %q", got)
+	}
+}
+
+func TestAskMemoryIncludesPreviousTurns(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	model := &recordingLLM{}
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	if _, err := authService.Login(context.Background(), 5, "pass"); err != nil {
+		t.Fatalf("failed to login test user: %v", err)
+	}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:      authService,
+		LLM:       model,
+		Bot:       bot,
+		Logger:    logger,
+		Dialogs:   llm.NewDialogService(model, llm.NewMemoryDialogStore(time.Hour, 0), llm.DialogServiceConfig{}),
+		AskMemory: true,
+	})
+
+	sendUpdate(t, handler, 5, "/ask")
+	waitForMessages(t, bot, 1, 500*time.Millisecond)
+	sendUpdate(t, handler, 5, "first question")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+	sendUpdate(t, handler, 5, "follow-up")
+	waitForMessages(t, bot, 5, 500*time.Millisecond)
+
+	calls := model.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 llm calls, got %d", len(calls))
+	}
+	second := calls[1]
+	if len(second) != 3 || second[0].Content != "first question" || second[1].Role != llm.RoleAssistant || second[2].Content != "follow-up" {
+		t.Fatalf("expected follow-up to include previous turn, got %+v", second)
+	}
+
+	sendUpdate(t, handler, 5, "/end")
+	waitForMessages(t, bot, 6, 500*time.Millisecond)
+	sendUpdate(t, handler, 5, "/ask fresh start")
+	waitForMessages(t, bot, 9, 500*time.Millisecond)
+
+	calls = model.Calls()
+	if last := calls[len(calls)-1]; len(last) != 1 {
+		t.Fatalf("expected history to be cleared after /end, got %+v", last)
+	}
+}
+
+// primaryDownLLM отвечает только резервной моделью "backup".
+type primaryDownLLM struct {
+	recordingLLM
+}
+
+func (p *primaryDownLLM) ChatCompletion(ctx context.Context, prompt string, model string) (string, error) {
+	return p.ChatWithMessages(ctx, model, []llm.Message{{Role: llm.RoleUser, Content: prompt}})
+}
+
+func (p *primaryDownLLM) ChatWithMessages(ctx context.Context, model string, messages []llm.Message, opts ...llm.ChatOption) (string, error) {
+	if model != "backup" {
+		return "", errors.New("primary unavailable")
+	}
+	return p.recordingLLM.ChatWithMessages(ctx, model, messages, opts...)
+}
+
+func TestFallbackAnswerIsAnnotatedOutsideHistory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	bot := &stubBot{}
+	inner := &primaryDownLLM{}
+	model := llm.NewFallbackClient(inner, "", []string{"backup"}, nil)
+	authService := auth.NewService("pass", time.Hour, auth.NewMemoryStore())
+	for _, id := range []int64{1, 2} {
+		if _, err := authService.Login(context.Background(), id, "pass"); err != nil {
+			t.Fatalf("login: %v", err)
+		}
+	}
+	handler := NewWebhookHandler(WebhookDeps{
+		Auth:      authService,
+		LLM:       model,
+		Bot:       bot,
+		Logger:    logger,
+		Dialogs:   llm.NewDialogService(model, llm.NewMemoryDialogStore(time.Hour, 0), llm.DialogServiceConfig{}),
+		AskMemory: true,
+	})
+
+	sendUpdate(t, handler, 1, "/ask first question")
+	waitForMessages(t, bot, 3, 500*time.Millisecond)
+	if got := bot.SentTo(1)[2]; got != "answer\n\n(ответ резервной модели backup)" {
+		t.Fatalf("expected localized fallback note, got %q", got)
+	}
+	sendUpdate(t, handler, 1, "follow-up")
+	waitForMessages(t, bot, 5, 500*time.Millisecond)
+	calls := inner.Calls()
+	if got := calls[len(calls)-1][1].Content; got != "answer" {
+		t.Fatalf("expected fallback note to stay out of dialog history, got %q", got)
+	}
+
+	sendMessage(t, handler, &Message{Text: "/ask question", Chat: Chat{ID: 2}, From: &User{ID: 2, LanguageCode: "en"}})
+	waitForMessages(t, bot, 8, 500*time.Millisecond)
+	if got := bot.SentTo(2)[2]; got != "answer\n\n(answer from fallback model backup)" {
+		t.Fatalf("expected english fallback note, got %q", got)
+	}
+}